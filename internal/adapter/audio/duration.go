@@ -0,0 +1,203 @@
+package audio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned for audio formats whose duration can't be read.
+var ErrUnsupported = errors.New("unsupported audio format")
+
+// Prober reads the duration of audio attachments from their container
+// headers, without decoding the audio or calling any external tool.
+// OGG/Opus (WhatsApp voice messages) and MP4/M4A are supported.
+type Prober struct{}
+
+func (Prober) Duration(fsys fs.FS, name string) (time.Duration, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(path.Ext(name)) {
+	case ".opus", ".ogg":
+		return oggDuration(bufio.NewReader(f))
+	case ".m4a", ".mp4", ".aac":
+		return mp4Duration(f)
+	default:
+		return 0, ErrUnsupported
+	}
+}
+
+// opusRate is the granule rate of Opus streams, regardless of the rate of
+// the encoded audio.
+const opusRate = 48000
+
+// oggDuration reads the page headers of an OGG/Opus stream. The duration is
+// the granule position of the last page minus the pre-skip declared in the
+// OpusHead packet, in 48 kHz samples. A truncated stream, e.g. one missing
+// its last pages, counts up to its last complete page.
+func oggDuration(r io.Reader) (time.Duration, error) {
+	var (
+		header    [27]byte
+		segments  [255]byte
+		preSkip   uint64
+		granule   uint64
+		seenFirst bool
+	)
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if seenFirst && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+				break
+			}
+			return 0, fmt.Errorf("reading ogg page: %w", err)
+		}
+		if string(header[:4]) != "OggS" {
+			return 0, errors.New("not an ogg stream")
+		}
+
+		n := int(header[26])
+		if _, err := io.ReadFull(r, segments[:n]); err != nil {
+			if seenFirst && errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return 0, fmt.Errorf("reading ogg page: %w", err)
+		}
+		size := 0
+		for _, s := range segments[:n] {
+			size += int(s)
+		}
+
+		if !seenFirst {
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return 0, fmt.Errorf("reading ogg page: %w", err)
+			}
+			if len(body) < 12 || !bytes.HasPrefix(body, []byte("OpusHead")) {
+				return 0, ErrUnsupported
+			}
+			preSkip = uint64(binary.LittleEndian.Uint16(body[10:12]))
+			seenFirst = true
+			continue
+		}
+
+		if _, err := io.CopyN(io.Discard, r, int64(size)); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, fmt.Errorf("reading ogg page: %w", err)
+		}
+		// -1 marks pages on which no packet ends.
+		if g := binary.LittleEndian.Uint64(header[6:14]); g != ^uint64(0) {
+			granule = g
+		}
+	}
+
+	if granule < preSkip {
+		return 0, nil
+	}
+	return time.Duration((granule - preSkip) * uint64(time.Second) / opusRate), nil
+}
+
+// mp4Duration reads the timescale and duration from the movie header box
+// (moov/mvhd). The moov box may follow the media data, which is skipped.
+func mp4Duration(r io.Reader) (time.Duration, error) {
+	for {
+		typ, size, err := readBox(r)
+		if err != nil {
+			return 0, err
+		}
+		if typ == "moov" {
+			return mvhdDuration(io.LimitReader(r, size))
+		}
+		if _, err := io.CopyN(io.Discard, r, size); err != nil {
+			return 0, fmt.Errorf("reading mp4 box %s: %w", typ, err)
+		}
+	}
+}
+
+func mvhdDuration(r io.Reader) (time.Duration, error) {
+	for {
+		typ, size, err := readBox(r)
+		if err != nil {
+			return 0, err
+		}
+		if typ != "mvhd" {
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return 0, fmt.Errorf("reading mp4 box %s: %w", typ, err)
+			}
+			continue
+		}
+
+		var version [4]byte // version and flags
+		if _, err := io.ReadFull(r, version[:]); err != nil {
+			return 0, fmt.Errorf("reading mvhd: %w", err)
+		}
+
+		var timescale, duration uint64
+		if version[0] == 1 {
+			var v1 struct {
+				Created, Modified uint64
+				Timescale         uint32
+				Duration          uint64
+			}
+			if err := binary.Read(r, binary.BigEndian, &v1); err != nil {
+				return 0, fmt.Errorf("reading mvhd: %w", err)
+			}
+			timescale, duration = uint64(v1.Timescale), v1.Duration
+		} else {
+			var v0 struct {
+				Created, Modified, Timescale, Duration uint32
+			}
+			if err := binary.Read(r, binary.BigEndian, &v0); err != nil {
+				return 0, fmt.Errorf("reading mvhd: %w", err)
+			}
+			timescale, duration = uint64(v0.Timescale), uint64(v0.Duration)
+		}
+
+		if timescale == 0 {
+			return 0, errors.New("mvhd without timescale")
+		}
+		return time.Duration(float64(duration) / float64(timescale) * float64(time.Second)), nil
+	}
+}
+
+// readBox reads a box header and returns the box type and the size of its
+// content.
+func readBox(r io.Reader) (string, int64, error) {
+	var h [8]byte
+	if _, err := io.ReadFull(r, h[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return "", 0, errors.New("no movie header found")
+		}
+		return "", 0, fmt.Errorf("reading mp4 box: %w", err)
+	}
+
+	size := int64(binary.BigEndian.Uint32(h[:4]))
+	typ := string(h[4:8])
+	switch size {
+	case 1: // 64-bit size follows
+		var large uint64
+		if err := binary.Read(r, binary.BigEndian, &large); err != nil {
+			return "", 0, fmt.Errorf("reading mp4 box %s: %w", typ, err)
+		}
+		size = int64(large) - 16 //nolint:gosec // box sizes are far below 2^63
+	case 0: // box extends to the end of the file
+		size = 1 << 62
+	default:
+		size -= 8
+	}
+	if size < 0 {
+		return "", 0, fmt.Errorf("invalid size of mp4 box %s", typ)
+	}
+	return typ, size, nil
+}
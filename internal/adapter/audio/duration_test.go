@@ -0,0 +1,179 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// oggPage builds an OGG page with the given granule position and body. The
+// checksum is left zero, as the parser doesn't verify it.
+func oggPage(granule uint64, body []byte) []byte {
+	var lacing []byte
+	n := len(body)
+	for ; n >= 255; n -= 255 {
+		lacing = append(lacing, 255)
+	}
+	lacing = append(lacing, byte(n))
+
+	h := make([]byte, 27)
+	copy(h, "OggS")
+	binary.LittleEndian.PutUint64(h[6:14], granule)
+	h[26] = byte(len(lacing))
+	return concat(h, lacing, body)
+}
+
+func opusHead(preSkip uint16) []byte {
+	body := make([]byte, 19)
+	copy(body, "OpusHead")
+	body[8] = 1 // version
+	body[9] = 1 // channels
+	binary.LittleEndian.PutUint16(body[10:12], preSkip)
+	return body
+}
+
+// box builds an MP4 box with a 32-bit size.
+func box(typ string, content ...[]byte) []byte {
+	body := concat(content...)
+	h := make([]byte, 8)
+	binary.BigEndian.PutUint32(h, uint32(8+len(body)))
+	copy(h[4:], typ)
+	return concat(h, body)
+}
+
+// largeBox builds an MP4 box with a 64-bit size.
+func largeBox(typ string, content ...[]byte) []byte {
+	body := concat(content...)
+	h := make([]byte, 16)
+	binary.BigEndian.PutUint32(h, 1)
+	copy(h[4:], typ)
+	binary.BigEndian.PutUint64(h[8:], uint64(16+len(body)))
+	return concat(h, body)
+}
+
+func mvhdV0(timescale, duration uint32) []byte {
+	b := make([]byte, 20)
+	binary.BigEndian.PutUint32(b[12:], timescale)
+	binary.BigEndian.PutUint32(b[16:], duration)
+	return box("mvhd", b)
+}
+
+func mvhdV1(timescale uint32, duration uint64) []byte {
+	b := make([]byte, 32)
+	b[0] = 1
+	binary.BigEndian.PutUint32(b[20:], timescale)
+	binary.BigEndian.PutUint64(b[24:], duration)
+	return box("mvhd", b)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestDuration(t *testing.T) {
+	audio := make([]byte, 300) // spans two lacing values
+	head := oggPage(0, opusHead(312))
+
+	tests := []struct {
+		name    string
+		file    string
+		data    []byte
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "ogg pre-skip",
+			file: "voice.opus",
+			data: concat(head, oggPage(0, nil), oggPage(48000*5+312, audio)),
+			want: 5 * time.Second,
+		},
+		{
+			name: "ogg page without packet end",
+			file: "voice.ogg",
+			data: concat(head, oggPage(48000*3+312, audio), oggPage(^uint64(0), audio)),
+			want: 3 * time.Second,
+		},
+		{
+			name: "ogg missing last page",
+			file: "voice.opus",
+			data: concat(head, oggPage(48000*2+312, audio), oggPage(48000*4+312, audio)[:40]),
+			want: 2 * time.Second,
+		},
+		{
+			name: "ogg only head",
+			file: "voice.opus",
+			data: head,
+		},
+		{
+			name:    "ogg truncated head",
+			file:    "voice.opus",
+			data:    head[:30],
+			wantErr: true,
+		},
+		{
+			name:    "not ogg",
+			file:    "voice.opus",
+			data:    make([]byte, 64),
+			wantErr: true,
+		},
+		{
+			name: "m4a moov after mdat",
+			file: "audio.m4a",
+			data: concat(box("ftyp", []byte("M4A \x00\x00\x00\x00")), box("mdat", audio),
+				box("moov", box("udta"), mvhdV0(44100, 44100*90))),
+			want: 90 * time.Second,
+		},
+		{
+			name: "mp4 64-bit mvhd",
+			file: "video.MP4",
+			data: box("moov", mvhdV1(1000, 1<<33)),
+			want: (1 << 33) * time.Millisecond,
+		},
+		{
+			name: "m4a 64-bit box size",
+			file: "audio.m4a",
+			data: concat(largeBox("mdat", audio), box("moov", mvhdV0(600, 1500))),
+			want: 2500 * time.Millisecond,
+		},
+		{
+			name:    "m4a without moov",
+			file:    "audio.m4a",
+			data:    concat(box("ftyp"), box("mdat", audio)),
+			wantErr: true,
+		},
+		{
+			name:    "m4a without timescale",
+			file:    "audio.m4a",
+			data:    box("moov", mvhdV0(0, 100)),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{tt.file: {Data: tt.data}}
+			got, err := Prober{}.Duration(fsys, tt.file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Duration() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Duration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDurationUnsupported(t *testing.T) {
+	fsys := fstest.MapFS{
+		"audio.wav": {Data: []byte("RIFF")},
+		"audio.ogg": {Data: oggPage(0, []byte("\x01vorbis"))},
+	}
+	for name := range fsys {
+		if _, err := (Prober{}).Duration(fsys, name); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Duration(%s) error = %v, want ErrUnsupported", name, err)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// Entry is a cached transcript.
+type Entry struct {
+	Text     string           `json:"text"`
+	Segments []domain.Segment `json:"segments,omitempty"`
+	// Source is the attachment the transcript was created from, for
+	// reference only; entries are looked up by key.
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FileStore keeps one JSON file per entry in Dir. Reading an entry updates
+// its modification time, so Prune removes entries that were not used
+// recently. It is safe for concurrent use.
+type FileStore struct {
+	Dir string
+}
+
+// Get returns the entry for key, or nil if there is none.
+func (s *FileStore) Get(key string) (*Entry, error) {
+	p := s.path(key)
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return &e, nil
+}
+
+func (s *FileStore) Put(key string, e *Entry) error {
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o750); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	// Several workers may store the same audio (e.g. a forwarded voice
+	// message), so each writes its own temp file before renaming.
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Stats describes the contents of a store.
+type Stats struct {
+	Entries int
+	Bytes   int64
+	// Oldest and Newest are the last use of the least and most recently
+	// used entries.
+	Oldest, Newest time.Time
+}
+
+func (s *FileStore) Stats() (Stats, error) {
+	var st Stats
+	err := s.walk(func(_ string, info fs.FileInfo) error {
+		st.Entries++
+		st.Bytes += info.Size()
+		if st.Oldest.IsZero() || info.ModTime().Before(st.Oldest) {
+			st.Oldest = info.ModTime()
+		}
+		if info.ModTime().After(st.Newest) {
+			st.Newest = info.ModTime()
+		}
+		return nil
+	})
+	return st, err
+}
+
+// Prune removes the entries last used before t and returns their number.
+func (s *FileStore) Prune(t time.Time) (int, error) {
+	n := 0
+	err := s.walk(func(p string, info fs.FileInfo) error {
+		if !info.ModTime().Before(t) {
+			return nil
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// Clear removes all entries.
+func (s *FileStore) Clear() error {
+	return os.RemoveAll(s.Dir)
+}
+
+// path spreads entries over subdirectories named after the first two
+// characters of the key, which is expected to be a hex hash.
+func (s *FileStore) path(key string) string {
+	if len(key) < 3 {
+		return filepath.Join(s.Dir, key+".json")
+	}
+	return filepath.Join(s.Dir, key[:2], key[2:]+".json")
+}
+
+func (s *FileStore) walk(fn func(path string, info fs.FileInfo) error) error {
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(p) != ".json" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return fn(p, info)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,145 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// detectSampleLines is the number of lines sampled for format detection.
+const detectSampleLines = 500
+
+// Detection describes the export format chosen for a chat file.
+type Detection struct {
+	Platform string
+	Locale   string
+	// DateOrder is the detected date order (e.g. "DD/MM/YY").
+	DateOrder string
+	// Matched is the number of sampled header lines the format parsed.
+	Matched int
+	// Candidates is the number of sampled lines any known format matched.
+	Candidates int
+	// Confidence is Matched / Candidates.
+	Confidence float64
+	// Ambiguous is set when the sample did not contain a day or month value
+	// above 12, so a different date order would have parsed equally well.
+	Ambiguous bool
+}
+
+func (d *Detection) String() string {
+	s := fmt.Sprintf("%s, locale %s (%s), %d/%d lines, confidence %.0f%%",
+		d.Platform, d.Locale, d.DateOrder, d.Matched, d.Candidates, d.Confidence*100)
+	if d.Ambiguous {
+		s += ", day/month order ambiguous"
+	}
+	return s
+}
+
+// layoutScore collects how well a layout fits the sampled lines.
+type layoutScore struct {
+	matched   int // lines with a valid timestamp
+	monotonic int // consecutive matches with non-decreasing timestamps
+	keywords  int // locale keyword hits
+	prev      time.Time
+}
+
+func (a layoutScore) better(b layoutScore) bool {
+	if a.matched != b.matched {
+		return a.matched > b.matched
+	}
+	if a.monotonic != b.monotonic {
+		return a.monotonic > b.monotonic
+	}
+	return a.keywords > b.keywords
+}
+
+// detectLayout samples the first lines of r and returns the layout among
+// lays that parses most of them.
+func detectLayout(r io.Reader, lays []layout) (layout, *Detection, error) {
+	var sample []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024)
+	for len(sample) < detectSampleLines && scanner.Scan() {
+		sample = append(sample, stripInvisible(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return layout{}, nil, err
+	}
+
+	scores := make([]layoutScore, len(lays))
+	candidates := 0
+	for _, line := range sample {
+		seen := false
+		for i := range lays {
+			if scoreLine(&lays[i], line, &scores[i]) {
+				seen = true
+			}
+		}
+		if seen {
+			candidates++
+		}
+	}
+
+	best := -1
+	for i := range lays {
+		if scores[i].matched == 0 {
+			continue
+		}
+		if best < 0 || scores[i].better(scores[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return layout{}, nil, fmt.Errorf("no known WhatsApp message format found in the first %d lines", len(sample))
+	}
+
+	winner := lays[best]
+	det := &Detection{
+		Platform:   winner.platform.String(),
+		Locale:     winner.locale.Name,
+		DateOrder:  winner.locale.Order.String(),
+		Matched:    scores[best].matched,
+		Candidates: candidates,
+		Confidence: float64(scores[best].matched) / float64(candidates),
+	}
+
+	// The order is ambiguous if a layout of the same platform with a
+	// different date order parsed just as many lines, i.e. no value > 12
+	// ruled it out.
+	for i := range lays {
+		if lays[i].platform == winner.platform && lays[i].locale.Order != winner.locale.Order &&
+			scores[i].matched == scores[best].matched {
+			det.Ambiguous = true
+			break
+		}
+	}
+
+	return winner, det, nil
+}
+
+// scoreLine updates s for one sampled line and reports whether the layout's
+// regex matched it at all (even with an invalid date).
+func scoreLine(l *layout, line string, s *layoutScore) bool {
+	m := l.re.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	// Only the order of timestamps matters here, so DST is irrelevant.
+	ts, err := l.timestamp(m, time.UTC)
+	if err != nil {
+		return true
+	}
+	if s.matched > 0 && !ts.Before(s.prev) {
+		s.monotonic++
+	}
+	s.matched++
+	s.prev = ts
+	for _, kw := range l.locale.Keywords {
+		if strings.Contains(line, kw) {
+			s.keywords++
+		}
+	}
+	return true
+}
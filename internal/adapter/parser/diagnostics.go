@@ -0,0 +1,22 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Diagnostic reports a problem found while parsing a chat file.
+type Diagnostic struct {
+	Line   int    // 1-based line number in the chat file
+	Reason string // what is wrong
+	Raw    string // the offending line (without invisible characters)
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("line %d: %s: %q", d.Line, d.Reason, d.Raw)
+}
+
+// headerLikeRe matches lines that start like a message header (date and
+// time) of any layout. Continuation lines matching it usually mean the
+// export format drifted from the detected one.
+var headerLikeRe = regexp.MustCompile(`^\[?\d{1,4}[./-]\d{1,2}[./-]\d{2,4}\D{1,4}\d{1,2}:\d{2}`)
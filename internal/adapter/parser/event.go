@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// eventRule maps a system message pattern to an event kind. The group
+// indices point at the actor, the affected participants and a value (e.g.
+// the new subject); 0 means the pattern has no such group.
+type eventRule struct {
+	kind         domain.SystemEventKind
+	re           *regexp.Regexp
+	actor        int
+	participants int
+	value        int
+}
+
+// quote matches the quotation marks WhatsApp uses around group subjects.
+const quote = `["„“”«»]`
+
+// callSuffix matches what may follow a call notice: a duration or the hint
+// to call back, e.g. ", Zum Zurückrufen tippen".
+const callSuffix = `(?:,? (?:\d+(?::\d{2})+|\d+ (?:Min|Sek|min|sec|s)\.?|Zum Zurückrufen tippen|Tap to call back|Click to call back))?\.?$`
+
+// eventRules lists the known system messages (German and English; the
+// encryption notice in all supported languages). More specific patterns
+// come first.
+var eventRules = []eventRule{
+	{kind: domain.EventEncryptionNotice, re: regexp.MustCompile(`^(?:Nachrichten und Anrufe sind Ende-zu-Ende-verschlüsselt|Messages and calls are end-to-end encrypted|Les messages et les appels sont chiffrés de bout en bout|Los mensajes y las llamadas están cifrados de extremo a extremo|I messaggi e le chiamate sono crittografati end-to-end|As mensagens e as chamadas são protegidas com a criptografia de ponta a ponta|Berichten en gesprekken worden end-to-end versleuteld)`)},
+	{kind: domain.EventMissedVoiceCall, re: regexp.MustCompile(`^(?i:Verpasster Sprachanruf|Missed voice call)` + callSuffix)},
+	{kind: domain.EventMissedVideoCall, re: regexp.MustCompile(`^(?i:Verpasster Videoanruf|Missed video call)` + callSuffix)},
+	{kind: domain.EventSecurityCodeChanged, re: regexp.MustCompile(`^Deine Sicherheitsnummer für (.+?) hat sich geändert`), participants: 1},
+	{kind: domain.EventSecurityCodeChanged, re: regexp.MustCompile(`^Your security code with (.+?) changed`), participants: 1},
+
+	{kind: domain.EventNumberChanged, re: regexp.MustCompile(`^(.+?) (?:hat|hast) (?:die|deine) (?:Telefon)?[Nn]ummer (?:gewechselt|geändert)`), actor: 1},
+	{kind: domain.EventNumberChanged, re: regexp.MustCompile(`^(.+?) changed (?:their|your) phone number`), actor: 1},
+
+	{kind: domain.EventGroupCreated, re: regexp.MustCompile(`^(.+?) (?:hat|hast) die Gruppe ` + quote + `(.+)` + quote + ` erstellt\.?$`), actor: 1, value: 2},
+	{kind: domain.EventGroupCreated, re: regexp.MustCompile(`^(.+?) created (?:the )?group ` + quote + `(.+)` + quote + `$`), actor: 1, value: 2},
+
+	{kind: domain.EventGroupRenamed, re: regexp.MustCompile(`^(.+?) (?:hat|hast) den (?:Gruppen)?[Bb]etreff (?:von ` + quote + `.*?` + quote + ` )?(?:zu|in) ` + quote + `(.+)` + quote + ` geändert\.?$`), actor: 1, value: 2},
+	{kind: domain.EventGroupRenamed, re: regexp.MustCompile(`^(.+?) changed the (?:group name|subject) (?:from ` + quote + `.*?` + quote + ` )?to ` + quote + `(.+)` + quote + `$`), actor: 1, value: 2},
+
+	{kind: domain.EventDescriptionChanged, re: regexp.MustCompile(`^(.+?) (?:hat|hast) die Gruppenbeschreibung (?:geändert|gelöscht)\.?$`), actor: 1},
+	{kind: domain.EventDescriptionChanged, re: regexp.MustCompile(`^(.+?) (?:changed|deleted) the group description$`), actor: 1},
+
+	{kind: domain.EventIconChanged, re: regexp.MustCompile(`^(.+?) (?:hat|hast) (?:das )?Gruppenbild (?:geändert|gelöscht|entfernt)\.?$`), actor: 1},
+	{kind: domain.EventIconChanged, re: regexp.MustCompile(`^(.+?) (?:changed|deleted) this group's icon$`), actor: 1},
+
+	{kind: domain.EventMemberLeft, re: regexp.MustCompile(`^(.+?) (?:hat|hast) die Gruppe verlassen\.?$`), participants: 1},
+	{kind: domain.EventMemberLeft, re: regexp.MustCompile(`^(.+?) left$`), participants: 1},
+
+	{kind: domain.EventMemberJoined, re: regexp.MustCompile(`^(.+?) (?:ist|bist) der Gruppe (?:mit|über) (?:dem|den) Einladungslink beigetreten\.?$`), participants: 1},
+	{kind: domain.EventMemberJoined, re: regexp.MustCompile(`^(.+?) joined using this group's invite link$`), participants: 1},
+
+	{kind: domain.EventMemberAdded, re: regexp.MustCompile(`^(.+?) (?:hat|hast) (.+) hinzugefügt\.?$`), actor: 1, participants: 2},
+	{kind: domain.EventMemberAdded, re: regexp.MustCompile(`^(.+?) added (.+)$`), actor: 1, participants: 2},
+
+	{kind: domain.EventMemberRemoved, re: regexp.MustCompile(`^(.+?) (?:hat|hast) (.+) entfernt\.?$`), actor: 1, participants: 2},
+	{kind: domain.EventMemberRemoved, re: regexp.MustCompile(`^(.+?) removed (.+)$`), actor: 1, participants: 2},
+}
+
+// namesSplitRe splits participant lists like "Anna, Ben und Carla".
+var namesSplitRe = regexp.MustCompile(`, | und | and `)
+
+// isEvent reports whether content matches any known system message.
+func isEvent(content string) bool {
+	content = strings.TrimSpace(content)
+	for i := range eventRules {
+		if eventRules[i].re.MatchString(content) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyEvent sets Event on system messages. Events that iOS exports
+// with a sender (encryption notice, missed calls) are recognized as system
+// messages by parseMessageLine.
+func classifyEvent(msg *domain.Message) {
+	if msg.Type != domain.SystemMessage {
+		return
+	}
+
+	content := strings.TrimSpace(msg.Content)
+	for i := range eventRules {
+		rule := &eventRules[i]
+		m := rule.re.FindStringSubmatch(content)
+		if m == nil {
+			continue
+		}
+
+		event := &domain.SystemEvent{Kind: rule.kind, Actor: msg.Sender}
+		if rule.actor != 0 {
+			event.Actor = m[rule.actor]
+		}
+		if rule.participants != 0 {
+			event.Participants = namesSplitRe.Split(m[rule.participants], -1)
+		}
+		if rule.value != 0 {
+			event.Value = m[rule.value]
+		}
+
+		msg.Event = event
+		return
+	}
+
+	msg.Event = &domain.SystemEvent{Kind: domain.EventOther}
+}
@@ -0,0 +1,21 @@
+package parser
+
+import "testing"
+
+func TestIsEventCallNotices(t *testing.T) {
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"Verpasster Sprachanruf", true},
+		{"Missed voice call, Tap to call back", true},
+		{"Missed video call", true},
+		{"missed voice call from Ben, call him back", false},
+		{"Verpasster Videoanruf? Sorry, war unterwegs", false},
+	}
+	for _, tt := range tests {
+		if got := isEvent(tt.content); got != tt.want {
+			t.Errorf("isEvent(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
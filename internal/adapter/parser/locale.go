@@ -0,0 +1,266 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// dateOrder describes the order of day, month and year in an export's dates.
+type dateOrder int
+
+const (
+	orderDMY dateOrder = iota
+	orderMDY
+	orderYMD
+)
+
+func (o dateOrder) String() string {
+	switch o {
+	case orderMDY:
+		return "MM/DD/YY"
+	case orderYMD:
+		return "YY/MM/DD"
+	default:
+		return "DD/MM/YY"
+	}
+}
+
+// Locale describes the line grammar WhatsApp uses for one export language.
+type Locale struct {
+	// Name is the identifier used to select the locale (e.g. "de", "en-US").
+	Name string
+	// Order is the order of day, month and year.
+	Order dateOrder
+	// DateSep separates the date components (e.g. "." or "/").
+	DateSep string
+	// DateTimeSeps lists the separators seen between date and time.
+	DateTimeSeps []string
+	// AM and PM list the localized 12-hour clock markers. Empty for
+	// locales that only use a 24-hour clock.
+	AM []string
+	PM []string
+	// Keywords are phrases typical for exports in this language (attachment
+	// markers, the encryption notice). They break ties during detection
+	// between locales that share a date grammar.
+	Keywords []string
+}
+
+// Known locales. Order is the last tie-breaker during format detection.
+var locales = []Locale{
+	{
+		Name: "de", Order: orderDMY, DateSep: ".", DateTimeSeps: []string{", ", " um ", " "},
+		Keywords: []string{"<Anhang:", "(Datei angehängt)", "verschlüsselt", "ausgeschlossen>"},
+	},
+	{
+		Name: "en-US", Order: orderMDY, DateSep: "/", DateTimeSeps: []string{", ", " "},
+		AM: []string{"AM", "a.m."}, PM: []string{"PM", "p.m."},
+		Keywords: []string{"<attached:", "(file attached)", "encrypted", "<Media omitted>"},
+	},
+	{
+		Name: "en-GB", Order: orderDMY, DateSep: "/", DateTimeSeps: []string{", ", " "},
+		AM: []string{"am", "a.m."}, PM: []string{"pm", "p.m."},
+		Keywords: []string{"<attached:", "(file attached)", "encrypted", "<Media omitted>"},
+	},
+	{
+		Name: "fr", Order: orderDMY, DateSep: "/", DateTimeSeps: []string{", ", " à ", " "},
+		Keywords: []string{"<pièce jointe", "(fichier joint)", "chiffrés", "<Médias omis>"},
+	},
+	{
+		Name: "es", Order: orderDMY, DateSep: "/", DateTimeSeps: []string{", ", " "},
+		AM: []string{"a. m.", "a.m."}, PM: []string{"p. m.", "p.m."},
+		Keywords: []string{"<adjunto:", "(archivo adjunto)", "cifrados", "<Multimedia omitido>"},
+	},
+	{
+		Name: "it", Order: orderDMY, DateSep: "/", DateTimeSeps: []string{", ", " "},
+		Keywords: []string{"<allegato:", "(file allegato)", "crittografati", "<Media omessi>"},
+	},
+	{
+		Name: "pt", Order: orderDMY, DateSep: "/", DateTimeSeps: []string{", ", " "},
+		Keywords: []string{"<anexado:", "(arquivo anexado)", "criptografia", "<Mídia oculta>"},
+	},
+	{
+		Name: "nl", Order: orderDMY, DateSep: "-", DateTimeSeps: []string{", ", " "},
+		Keywords: []string{"<bijlage:", "(bestand bijgevoegd)", "versleuteld", "<Media weggelaten>"},
+	},
+	{Name: "iso", Order: orderYMD, DateSep: "-", DateTimeSeps: []string{", ", " "}},
+}
+
+// LocaleNames returns the names of all supported locales.
+func LocaleNames() []string {
+	names := make([]string, len(locales))
+	for i, l := range locales {
+		names[i] = l.Name
+	}
+	return names
+}
+
+// LookupLocale returns the locale with the given name (case-insensitive).
+func LookupLocale(name string) (Locale, bool) {
+	for _, l := range locales {
+		if strings.EqualFold(l.Name, name) {
+			return l, true
+		}
+	}
+	return Locale{}, false
+}
+
+// platform is the WhatsApp client that produced an export.
+type platform int
+
+const (
+	platformIOS platform = iota
+	platformAndroid
+)
+
+func (p platform) String() string {
+	if p == platformAndroid {
+		return "Android"
+	}
+	return "iOS"
+}
+
+// layout is a compiled line grammar for one platform × locale combination.
+//
+// Supported line shapes:
+//   - iOS:     [DATE, TIME] Sender: Text
+//   - Android: DATE, TIME - Sender: Text
+//
+// Lines without "Sender: " are system messages.
+type layout struct {
+	platform platform
+	locale   Locale
+	re       *regexp.Regexp
+}
+
+// Submatch indices of a layout regex.
+const (
+	subDate1 = iota + 1
+	subDate2
+	subDate3
+	subHour
+	subMinute
+	subSecond
+	subMeridiem
+	subRest
+)
+
+// senderRe splits the remainder of a header line into sender and text.
+var senderRe = regexp.MustCompile(`^([^:]+): (.*)$`)
+
+// layouts holds all known grammars, iOS first, in locale order.
+var layouts = buildLayouts(locales)
+
+func buildLayouts(ls []Locale) []layout {
+	var out []layout
+	for _, p := range []platform{platformIOS, platformAndroid} {
+		for _, l := range ls {
+			out = append(out, layout{platform: p, locale: l, re: compileLayout(p, l)})
+		}
+	}
+	return out
+}
+
+func compileLayout(p platform, l Locale) *regexp.Regexp {
+	sep := regexp.QuoteMeta(l.DateSep)
+	date := `(\d{1,4})` + sep + `(\d{1,2})` + sep + `(\d{2,4})`
+	clock := `(\d{1,2}):(\d{2})(?::(\d{2}))?`
+
+	// The meridiem group is always present so submatch indices stay stable.
+	meridiem := `()`
+	if markers := append(append([]string{}, l.AM...), l.PM...); len(markers) > 0 {
+		meridiem = `(?: ?((?i:` + quoteAll(markers) + `)))?`
+	}
+
+	header := date + `(?:` + quoteAll(l.DateTimeSeps) + `)` + clock + meridiem
+	if p == platformIOS {
+		return regexp.MustCompile(`^\[` + header + `\] (.*)$`)
+	}
+	return regexp.MustCompile(`^` + header + ` - (.*)$`)
+}
+
+func quoteAll(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = regexp.QuoteMeta(s)
+	}
+	return strings.Join(quoted, "|")
+}
+
+// layoutsFor returns the layouts of the named locale, or all layouts if
+// name is empty.
+func layoutsFor(name string) ([]layout, error) {
+	if name == "" {
+		return layouts, nil
+	}
+	l, ok := LookupLocale(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown locale %q (supported: %s)", name, strings.Join(LocaleNames(), ", "))
+	}
+	return buildLayouts([]Locale{l}), nil
+}
+
+// timestamp converts the date and time submatches of a layout match into a
+// time. Exports contain local wall-clock times; loc is the zone they were
+// written in.
+func (l *layout) timestamp(m []string, loc *time.Location) (time.Time, error) {
+	a, b, c := atoi(m[subDate1]), atoi(m[subDate2]), atoi(m[subDate3])
+
+	var year, month, day int
+	switch l.locale.Order {
+	case orderMDY:
+		month, day, year = a, b, c
+	case orderYMD:
+		year, month, day = a, b, c
+	default:
+		day, month, year = a, b, c
+	}
+	if year < 100 {
+		year += 2000
+	}
+
+	hour, minute, second := atoi(m[subHour]), atoi(m[subMinute]), atoi(m[subSecond])
+	if marker := m[subMeridiem]; marker != "" {
+		if hour < 1 || hour > 12 {
+			return time.Time{}, fmt.Errorf("invalid 12-hour clock value %d", hour)
+		}
+		pm := containsFold(l.locale.PM, marker)
+		switch {
+		case pm && hour < 12:
+			hour += 12
+		case !pm && hour == 12:
+			hour = 0
+		}
+	}
+
+	if month < 1 || month > 12 || hour > 23 || minute > 59 || second > 59 {
+		return time.Time{}, fmt.Errorf("invalid date/time %q %s:%s", m[subDate1]+l.locale.DateSep+m[subDate2]+l.locale.DateSep+m[subDate3], m[subHour], m[subMinute])
+	}
+
+	if day < 1 || day > daysIn(year, time.Month(month)) {
+		return time.Time{}, fmt.Errorf("invalid day %d for %d-%02d", day, year, month)
+	}
+	return domain.WallClock(year, time.Month(month), day, hour, minute, second, loc), nil
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, v := range ss {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
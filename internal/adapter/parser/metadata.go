@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// chatTitleRe extracts the chat name from export file names such as
+// "WhatsApp Chat - John", "WhatsApp-Chat mit John" or "WhatsApp Chat with John".
+var chatTitleRe = regexp.MustCompile(`(?i)^WhatsApp[- ]Chat(?: - | mit | with | avec | con | com | met )(.+)$`)
+
+// chatTitle derives the chat name from the export path or, for iOS zips
+// renamed by the user, from the chat file name.
+func chatTitle(exportPath, chatFile string) string {
+	for _, name := range []string{filepath.Base(exportPath), chatFile} {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+		if m := chatTitleRe.FindStringSubmatch(name); m != nil {
+			return strings.TrimSpace(m[1])
+		}
+	}
+
+	// Neither follows WhatsApp's naming; fall back to the given name unless
+	// it is the generic iOS chat file.
+	name := filepath.Base(exportPath)
+	if name == "_chat.txt" {
+		name = filepath.Base(filepath.Dir(exportPath))
+	}
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// metadata describes the chat read from src.
+func (s *source) metadata(exportPath string, participants []string) domain.Metadata {
+	meta := domain.Metadata{
+		Title:        chatTitle(exportPath, s.chatFile),
+		Participants: participants,
+		Platform:     s.det.Platform,
+		Locale:       s.det.Locale,
+	}
+
+	if info, err := fs.Stat(s.fsys, s.chatFile); err == nil {
+		meta.ExportedAt = info.ModTime()
+	}
+	return meta
+}
+
+// participants collects senders in order of their first message. System
+// messages are skipped, even those attributed to a sender.
+type participants struct {
+	names []string
+	seen  map[string]bool
+}
+
+func (p *participants) add(msg *domain.Message) {
+	if msg.Sender == "" || msg.Type == domain.SystemMessage || p.seen[msg.Sender] {
+		return
+	}
+	if p.seen == nil {
+		p.seen = make(map[string]bool)
+	}
+	p.seen[msg.Sender] = true
+	p.names = append(p.names, msg.Sender)
+}
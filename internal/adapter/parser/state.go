@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+var (
+	// editedRe matches the marker WhatsApp appends to edited messages,
+	// e.g. "<Diese Nachricht wurde bearbeitet.>" or "<This message was edited>".
+	editedRe = regexp.MustCompile(`\s*<(?:Diese Nachricht wurde bearbeitet|This message was edited|Ce message a été modifié|Se editó este mensaje|Questo messaggio è stato modificato|Mensagem editada|Dit bericht is bewerkt)\.?>$`)
+
+	// deletedRe matches the placeholder that replaces deleted messages.
+	deletedRe = regexp.MustCompile(`^(?:Diese Nachricht wurde gelöscht|Du hast diese Nachricht gelöscht|This message was deleted|You deleted this message|Ce message a été supprimé|Vous avez supprimé ce message|Se eliminó este mensaje|Eliminaste este mensaje|Questo messaggio è stato eliminato|Hai eliminato questo messaggio|Esta mensagem foi apagada|Você apagou esta mensagem|Dit bericht is verwijderd|Je hebt dit bericht verwijderd)\.?$`)
+
+	// viewOnceRe matches placeholders for "view once" media, which are never
+	// included in an export (e.g. "<View once voice message omitted>").
+	viewOnceRe = regexp.MustCompile(`(?i)^<[^<>]*(?:view once|einmalansicht|einmal ansehen|vue unique|visualización única|visualizzazione singola|visualização única|eenmalige weergave)[^<>]*>$`)
+
+	// mediaOmittedRe matches the generic placeholder of exports made
+	// "without media" (Android), e.g. "<Medien ausgeschlossen>".
+	mediaOmittedRe = regexp.MustCompile(`^<(?:Media omitted|Medien ausgeschlossen|Médias omis|Multimedia omitido|Media omessi|Mídia oculta|Media weggelaten)>$`)
+	// typedOmittedRe matches the iOS placeholders that name the media kind,
+	// e.g. "audio omitted" or "Bild weggelassen".
+	typedOmittedRe = regexp.MustCompile(`(?i)^(image|audio|video|sticker|document|GIF|Contact card|Bild|Audio|Video|Sticker|Dokument|GIF|Kontaktkarte) (?:omitted|weggelassen|ausgelassen)$`)
+)
+
+// omittedTypes maps the media kind named in a placeholder to a message type.
+var omittedTypes = map[string]domain.MessageType{
+	"image":        domain.ImageMessage,
+	"bild":         domain.ImageMessage,
+	"audio":        domain.VoiceMessage,
+	"video":        domain.VideoMessage,
+	"sticker":      domain.StickerMessage,
+	"document":     domain.DocumentMessage,
+	"dokument":     domain.DocumentMessage,
+	"gif":          domain.GIFMessage,
+	"contact card": domain.ContactMessage,
+	"kontaktkarte": domain.ContactMessage,
+}
+
+// applyState detects edited, deleted, "view once" and media omitted markers
+// in a complete (possibly multiline) message and moves them from Content
+// into flags.
+func applyState(msg *domain.Message) {
+	if msg.Type == domain.SystemMessage {
+		return
+	}
+
+	if loc := editedRe.FindStringIndex(msg.Content); loc != nil {
+		msg.Edited = true
+		msg.Content = msg.Content[:loc[0]]
+	}
+
+	content := strings.TrimSpace(msg.Content)
+	switch {
+	case deletedRe.MatchString(content):
+		msg.Deleted = true
+		msg.Content = ""
+	case viewOnceRe.MatchString(content):
+		msg.ViewOnce = true
+		msg.Content = ""
+	case mediaOmittedRe.MatchString(content):
+		// The kind of media is unknown, so the message stays a text message.
+		msg.MediaMissing = true
+		msg.Content = ""
+	default:
+		if m := typedOmittedRe.FindStringSubmatch(content); m != nil && msg.Type == domain.TextMessage {
+			msg.Type = omittedTypes[strings.ToLower(m[1])]
+			msg.MediaMissing = true
+			msg.Content = ""
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+func TestApplyStateOmitted(t *testing.T) {
+	tests := []struct {
+		content     string
+		wantType    domain.MessageType
+		wantMissing bool
+	}{
+		{"audio omitted", domain.VoiceMessage, true},
+		{"Bild weggelassen", domain.ImageMessage, true},
+		{"<Medien ausgeschlossen>", domain.TextMessage, true},
+		{"Schau mal, das video omitted", domain.TextMessage, false},
+		{"Warum wurde das Bild weggelassen", domain.TextMessage, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			msg := domain.Message{Content: tt.content, Type: domain.TextMessage}
+			applyState(&msg)
+			if msg.Type != tt.wantType || msg.MediaMissing != tt.wantMissing {
+				t.Errorf("type %d, missing %v, want %d, %v", msg.Type, msg.MediaMissing, tt.wantType, tt.wantMissing)
+			}
+		})
+	}
+}
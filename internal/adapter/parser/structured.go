@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"bufio"
+	"io/fs"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+var (
+	// Poll header line, followed by the question and "OPTION: ..." lines.
+	pollRe       = regexp.MustCompile(`^(?:UMFRAGE|POLL|SONDAGE|ENCUESTA|SONDAGGIO|ENQUETE|PEILING) ?:$`)
+	pollOptionRe = regexp.MustCompile(`^(?:OPTION|OPCIÓN|OPZIONE|OPÇÃO|OPTIE) ?: (.*?)(?: \((\d+) [^)]*\))?$`)
+
+	// Static location: "Standort: https://maps.google.com/?q=52.52,13.40"
+	locationRe = regexp.MustCompile(`(?i)^(?:standort|location|localisation|ubicación|posizione|localização|locatie) ?: (https?://\S+)$`)
+	// Coordinates within a maps URL (?q=lat,lon, ?ll=lat,lon or @lat,lon).
+	coordsRe = regexp.MustCompile(`(?:[?&](?:q|ll|query)=|@)(-?\d+(?:\.\d+)?),\s*(-?\d+(?:\.\d+)?)`)
+	// Live location placeholder; exports contain no coordinates for it.
+	liveLocationRe = regexp.MustCompile(`(?i)^(?:live-standort wird geteilt|live location shared|position en direct partagée|ubicación en tiempo real compartida|posizione in tempo reale condivisa|localização em tempo real compartilhada|live locatie gedeeld)\.?$`)
+
+	seqPrefixRe = regexp.MustCompile(`^\d+-`)
+)
+
+// parseStructured turns poll and location text messages into structured
+// message types. It must run on complete (multiline) messages.
+func parseStructured(msg *domain.Message) {
+	if msg.Type != domain.TextMessage || msg.Deleted {
+		return
+	}
+
+	content := strings.TrimSpace(msg.Content)
+	switch {
+	case liveLocationRe.MatchString(content):
+		msg.Type = domain.LocationMessage
+		msg.Location = &domain.Location{Live: true}
+
+	case locationRe.MatchString(content):
+		url := locationRe.FindStringSubmatch(content)[1]
+		loc := &domain.Location{URL: url}
+		if m := coordsRe.FindStringSubmatch(url); m != nil {
+			loc.Latitude, _ = strconv.ParseFloat(m[1], 64)
+			loc.Longitude, _ = strconv.ParseFloat(m[2], 64)
+		}
+		msg.Type = domain.LocationMessage
+		msg.Location = loc
+
+	default:
+		if poll := parsePoll(content); poll != nil {
+			msg.Type = domain.PollMessage
+			msg.Poll = poll
+		}
+	}
+}
+
+func parsePoll(content string) *domain.Poll {
+	lines := strings.Split(content, "\n")
+	if len(lines) < 2 || !pollRe.MatchString(strings.TrimSpace(lines[0])) {
+		return nil
+	}
+
+	poll := &domain.Poll{}
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if m := pollOptionRe.FindStringSubmatch(line); m != nil {
+			votes, _ := strconv.Atoi(m[2])
+			poll.Options = append(poll.Options, domain.PollOption{Text: m[1], Votes: votes})
+			continue
+		}
+		// Everything before the first option belongs to the question.
+		if len(poll.Options) == 0 && line != "" {
+			if poll.Question != "" {
+				poll.Question += " "
+			}
+			poll.Question += line
+		}
+	}
+	return poll
+}
+
+// readContact reads name and phone numbers from a contact card. If the card
+// is not part of the export, the name is taken from the file name.
+func readContact(fsys fs.FS, name string) *domain.Contact {
+	// iOS prefixes attachments with a sequence number ("00000005-Max.vcf").
+	base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	contact := &domain.Contact{Name: seqPrefixRe.ReplaceAllString(base, "")}
+
+	f, err := fsys.Open(name)
+	if err != nil {
+		return contact
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		// Keys carry parameters, e.g. "TEL;type=CELL;waid=4915112345678".
+		field, _, _ := strings.Cut(key, ";")
+		switch strings.ToUpper(field) {
+		case "FN":
+			contact.Name = strings.TrimSpace(value)
+		case "TEL":
+			contact.Numbers = append(contact.Numbers, strings.TrimSpace(value))
+		}
+	}
+	return contact
+}
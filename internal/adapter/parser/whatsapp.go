@@ -5,6 +5,8 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"io/fs"
+	"iter"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -14,134 +16,262 @@ import (
 	"github.com/joern1811/wachat/internal/domain"
 )
 
-// WhatsAppParser parses WhatsApp chat exports (.zip files).
+// WhatsAppParser parses WhatsApp chat exports. An export can be given as the
+// original .zip file, an extracted directory or the bare chat .txt file.
 type WhatsAppParser struct {
-	// TempDir holds the path to the extracted files (set after Parse).
-	TempDir string
+	// Locale restricts format detection to one locale (see LocaleNames).
+	// Empty means the locale is detected automatically.
+	Locale string
+
+	// Location is the time zone the export's wall-clock times are
+	// interpreted in. nil means the system's local zone.
+	Location *time.Location
+
+	// Strict makes Parse and Stream fail if any diagnostics were collected.
+	Strict bool
+
+	// Detection describes the detected export format (set by Parse and Stream).
+	Detection *Detection
+	// Detections holds the Detection of every export opened, by export
+	// path, e.g. when several exports are merged.
+	Detections map[string]*Detection
+	// Diagnostics lists problems found in the chat file (set by Parse, or
+	// while a Stream is iterated).
+	Diagnostics []Diagnostic
+
+	closers []io.Closer
 }
 
-// Regex patterns for WhatsApp message lines.
-// Supports:
-//   - iOS DE:     [DD.MM.YY, HH:MM:SS] Sender: Text
-//   - iOS DE alt: [DD.MM.YYYY, HH:MM:SS] Sender: Text
-//   - Android DE: DD.MM.YY, HH:MM - Sender: Text
 var (
-	// iOS format: [DD.MM.YY(YY), HH:MM:SS] Sender: Text
-	iosRe = regexp.MustCompile(`^\[(\d{2}\.\d{2}\.\d{2,4}), (\d{2}:\d{2}:\d{2})\] ([^:]+): (.*)$`)
-	// Android DE format: DD.MM.YY, HH:MM - Sender: Text
-	androidRe = regexp.MustCompile(`^(\d{2}\.\d{2}\.\d{2}), (\d{2}:\d{2}) - ([^:]+): (.*)$`)
-	// System messages (no sender)
-	iosSystemRe     = regexp.MustCompile(`^\[(\d{2}\.\d{2}\.\d{2,4}), (\d{2}:\d{2}:\d{2})\] (.*)$`)
-	androidSystemRe = regexp.MustCompile(`^(\d{2}\.\d{2}\.\d{2}), (\d{2}:\d{2}) - (.*)$`)
-
 	// Attachment patterns
-	attachedRe = regexp.MustCompile(`\s*\(Datei angehängt\)\s*$|\s*\(file attached\)\s*$`)
+	attachedRe = regexp.MustCompile(`\s*\((?:Datei angehängt|file attached|fichier joint|archivo adjunto|file allegato|arquivo anexado|bestand bijgevoegd)\)\s*$`)
 	// <Anhang: filename> or <attached: filename>
-	anhangRe = regexp.MustCompile(`^<(?:Anhang|attached|Media omitted): (.+)>$`)
+	anhangRe = regexp.MustCompile(`^<(?:Anhang|attached|pièce jointe|adjunto|allegato|anexado|bijlage) ?: (.+)>$`)
 )
 
 func (p *WhatsAppParser) Parse(exportPath string) (*domain.Chat, error) {
-	tempDir, err := os.MkdirTemp("", "wachat-*")
+	src, err := p.open(exportPath)
 	if err != nil {
-		return nil, fmt.Errorf("creating temp dir: %w", err)
+		return nil, err
+	}
+
+	var (
+		messages []domain.Message
+		diags    []Diagnostic
+		people   participants
+	)
+	report := func(d Diagnostic) { diags = append(diags, d) }
+	for msg, err := range src.messages(report) {
+		if err != nil {
+			return nil, fmt.Errorf("parsing chat file: %w", err)
+		}
+		people.add(&msg)
+		messages = append(messages, msg)
 	}
-	p.TempDir = tempDir
+	p.Diagnostics = diags
 
-	if err := extractZip(exportPath, tempDir); err != nil {
-		return nil, fmt.Errorf("extracting zip: %w", err)
+	if p.Strict && len(diags) > 0 {
+		return nil, fmt.Errorf("strict mode: %d problem(s) in chat file, first: %s", len(diags), diags[0])
 	}
 
-	txtFile, err := findChatFile(tempDir)
+	return &domain.Chat{
+		Meta:     src.metadata(exportPath, people.names),
+		Messages: messages,
+		Media:    src.fsys,
+	}, nil
+}
+
+// Stream is like Parse, but reads the chat file while the returned stream is
+// iterated. The participants for the metadata are collected in a cheap first
+// pass over the message headers. Diagnostics accumulate during iteration.
+// In strict mode, the chat file is checked in a further pass before, so a
+// problem fails Stream before any message is handled.
+func (p *WhatsAppParser) Stream(exportPath string) (*domain.ChatStream, error) {
+	src, err := p.open(exportPath)
 	if err != nil {
-		return nil, fmt.Errorf("finding chat file: %w", err)
+		return nil, err
+	}
+
+	if p.Strict {
+		if err := p.validate(src); err != nil {
+			return nil, err
+		}
 	}
 
-	messages, err := parseTextFile(txtFile)
+	people, err := src.participants()
 	if err != nil {
 		return nil, fmt.Errorf("parsing chat file: %w", err)
 	}
 
-	// Set full paths for media references
-	for i := range messages {
-		if messages[i].MediaRef != "" {
-			messages[i].MediaRef = filepath.Join(tempDir, messages[i].MediaRef)
+	p.Diagnostics = nil
+	report := func(d Diagnostic) { p.Diagnostics = append(p.Diagnostics, d) }
+	strictErr := func() error {
+		if p.Strict && len(p.Diagnostics) > 0 {
+			return fmt.Errorf("strict mode: problem in chat file: %s", p.Diagnostics[0])
 		}
+		return nil
 	}
 
-	return &domain.Chat{Messages: messages}, nil
+	return &domain.ChatStream{
+		Meta:  src.metadata(exportPath, people),
+		Media: src.fsys,
+		Messages: func(yield func(domain.Message, error) bool) {
+			for msg, err := range src.messages(report) {
+				if err != nil {
+					yield(domain.Message{}, fmt.Errorf("parsing chat file: %w", err))
+					return
+				}
+				if err := strictErr(); err != nil {
+					yield(domain.Message{}, err)
+					return
+				}
+				if !yield(msg, nil) {
+					return
+				}
+			}
+			if err := strictErr(); err != nil {
+				yield(domain.Message{}, err)
+			}
+		},
+	}, nil
 }
 
-// Cleanup removes the temporary directory.
-func (p *WhatsAppParser) Cleanup() {
-	if p.TempDir != "" {
-		_ = os.RemoveAll(p.TempDir)
+// validate reads the whole chat file and fails on the first problem, for
+// strict mode.
+func (p *WhatsAppParser) validate(src *source) error {
+	p.Diagnostics = nil
+	report := func(d Diagnostic) { p.Diagnostics = append(p.Diagnostics, d) }
+	for _, err := range src.messages(report) {
+		if err != nil {
+			return fmt.Errorf("parsing chat file: %w", err)
+		}
 	}
+	if len(p.Diagnostics) > 0 {
+		return fmt.Errorf("strict mode: %d problem(s) in chat file, first: %s", len(p.Diagnostics), p.Diagnostics[0])
+	}
+	return nil
 }
 
-func extractZip(zipPath, destDir string) error {
-	r, err := zip.OpenReader(zipPath)
+// Detect only detects the export format from the first lines of the chat
+// file, without parsing the chat.
+func (p *WhatsAppParser) Detect(exportPath string) (*Detection, error) {
+	src, err := p.open(exportPath)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer r.Close()
+	return src.det, nil
+}
 
-	for _, f := range r.File {
-		// Sanitize path to prevent zip slip (G305)
-		name := filepath.Clean(f.Name)
-		if strings.Contains(name, "..") {
-			continue
-		}
-		destPath := filepath.Join(destDir, name)
+// source is an opened export together with its detected chat format.
+type source struct {
+	fsys     fs.FS
+	chatFile string
+	lay      layout
+	det      *Detection
+	loc      *time.Location
+}
 
-		if f.FileInfo().IsDir() {
-			if err := os.MkdirAll(destPath, 0o750); err != nil {
-				return err
-			}
-			continue
-		}
+// open opens an export and detects the format of its chat file.
+func (p *WhatsAppParser) open(exportPath string) (*source, error) {
+	lays, err := layoutsFor(p.Locale)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := os.MkdirAll(filepath.Dir(destPath), 0o750); err != nil {
-			return err
-		}
+	fsys, chatFile, err := p.openSource(exportPath)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := extractZipFile(f, destPath); err != nil {
-			return err
-		}
+	lay, det, err := detectFileLayout(fsys, chatFile, lays)
+	if err != nil {
+		return nil, fmt.Errorf("detecting chat format: %w", err)
 	}
-	return nil
+	p.Detection = det
+	if p.Detections == nil {
+		p.Detections = make(map[string]*Detection)
+	}
+	p.Detections[exportPath] = det
+
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	return &source{fsys: fsys, chatFile: chatFile, lay: lay, det: det, loc: loc}, nil
 }
 
-func extractZipFile(f *zip.File, destPath string) error {
-	outFile, err := os.Create(destPath)
-	if err != nil {
-		return err
+// Cleanup releases the exports opened by Parse and Stream (e.g. closes zip files).
+func (p *WhatsAppParser) Cleanup() {
+	for _, c := range p.closers {
+		_ = c.Close()
 	}
-	defer outFile.Close()
+	p.closers = nil
+}
 
-	rc, err := f.Open()
+// openSource returns a file system rooted where media references are
+// resolved, and the chat file's path within it. Zip exports are read in
+// place: attachments are only decompressed when they are opened.
+func (p *WhatsAppParser) openSource(exportPath string) (fs.FS, string, error) {
+	info, err := os.Stat(exportPath)
 	if err != nil {
-		return err
+		return nil, "", fmt.Errorf("opening export: %w", err)
 	}
-	defer rc.Close()
 
-	// Limit extraction size to 1 GB to prevent decompression bombs (G110)
-	const maxSize = 1 << 30
-	_, err = io.Copy(outFile, io.LimitReader(rc, maxSize))
-	return err
+	var fsys fs.FS
+	switch {
+	case info.IsDir():
+		fsys = os.DirFS(exportPath)
+
+	case strings.EqualFold(filepath.Ext(exportPath), ".txt"):
+		return os.DirFS(filepath.Dir(exportPath)), filepath.Base(exportPath), nil
+
+	default:
+		r, err := zip.OpenReader(exportPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("opening zip: %w", err)
+		}
+		p.closers = append(p.closers, r)
+		fsys = limitedFS{FS: r, max: maxEntrySize}
+	}
+
+	chatFile, err := findChatFile(fsys)
+	if err != nil {
+		return nil, "", fmt.Errorf("finding chat file: %w", err)
+	}
+	return fsys, chatFile, nil
 }
 
-func findChatFile(dir string) (string, error) {
-	entries, err := os.ReadDir(dir)
+// findChatFile returns the chat file of an export: "_chat.txt" (iOS) or a
+// file named like "WhatsApp Chat - John.txt" (Android). Other .txt files may
+// be shared documents, so a differently named one is only taken if it is
+// the only one.
+func findChatFile(fsys fs.FS) (string, error) {
+	entries, err := fs.ReadDir(fsys, ".")
 	if err != nil {
 		return "", err
 	}
 
+	var texts []string
 	for _, e := range entries {
-		if !e.IsDir() && strings.HasSuffix(strings.ToLower(e.Name()), ".txt") {
-			return filepath.Join(dir, e.Name()), nil
+		name := e.Name()
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(name), ".txt") {
+			continue
+		}
+		if name == "_chat.txt" || chatTitleRe.MatchString(strings.TrimSuffix(name, filepath.Ext(name))) {
+			return name, nil
 		}
+		texts = append(texts, name)
+	}
+
+	switch len(texts) {
+	case 0:
+		return "", fmt.Errorf("no .txt chat file found in export")
+	case 1:
+		return texts[0], nil
+	default:
+		return "", fmt.Errorf("several .txt files in export, none named like a chat file: %s", strings.Join(texts, ", "))
 	}
-	return "", fmt.Errorf("no .txt chat file found in export")
 }
 
 // stripInvisible removes Unicode control characters (LTR mark, zero-width spaces, etc.)
@@ -154,109 +284,177 @@ func stripInvisible(s string) string {
 			return -1
 		case r == '\ufeff': // BOM
 			return -1
+		case r == '\u202f' || r == '\u00a0': // narrow / no-break space (e.g. before "PM")
+			return ' '
 		default:
 			return r
 		}
 	}, s)
 }
 
-func parseTextFile(path string) ([]domain.Message, error) {
-	f, err := os.Open(path)
+func detectFileLayout(fsys fs.FS, name string, lays []layout) (layout, *Detection, error) {
+	f, err := fsys.Open(name)
 	if err != nil {
-		return nil, err
+		return layout{}, nil, err
 	}
 	defer f.Close()
 
-	var messages []domain.Message
-	scanner := bufio.NewScanner(f)
+	return detectLayout(f, lays)
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 1024*1024), 1024*1024)
+	return scanner
+}
 
-	for scanner.Scan() {
-		line := stripInvisible(scanner.Text())
+// messages reads the chat file lazily. A message is yielded as soon as the
+// next header line shows that it has no further continuation lines, so only
+// one message is held in memory at a time. Problems are passed to report.
+func (s *source) messages(report func(Diagnostic)) iter.Seq2[domain.Message, error] {
+	return func(yield func(domain.Message, error) bool) {
+		f, err := s.fsys.Open(s.chatFile)
+		if err != nil {
+			yield(domain.Message{}, err)
+			return
+		}
+		defer f.Close()
+
+		var (
+			msg     domain.Message
+			msgLine int // header line number of msg; 0 before the first message
+		)
+		flush := func() bool {
+			if msgLine == 0 {
+				return true
+			}
+			s.complete(&msg, msgLine, report)
+			return yield(msg, nil)
+		}
+
+		scanner := newLineScanner(f)
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			raw := scanner.Text()
+			line := stripInvisible(raw)
+
+			next, ok, err := parseMessageLine(raw, &s.lay, s.loc)
+			switch {
+			case err != nil:
+				report(Diagnostic{Line: lineNo, Reason: fmt.Sprintf("unparseable date (%v)", err), Raw: line})
+			case ok:
+				if msgLine > 0 && next.Timestamp.Before(msg.Timestamp) {
+					report(Diagnostic{Line: lineNo, Reason: "timestamp earlier than previous message", Raw: line})
+				}
+				if !flush() {
+					return
+				}
+				msg, msgLine = next, lineNo
+				continue
+			case headerLikeRe.MatchString(line):
+				report(Diagnostic{Line: lineNo, Reason: "looks like a message header but does not match the detected format", Raw: line})
+			}
 
-		if msg, ok := parseMessageLine(line); ok {
-			messages = append(messages, msg)
-		} else if len(messages) > 0 {
+			if msgLine == 0 {
+				if line != "" {
+					report(Diagnostic{Line: lineNo, Reason: "text before the first message dropped", Raw: line})
+				}
+				continue
+			}
 			// Multiline: append to previous message content
-			messages[len(messages)-1].Content += "\n" + line
+			msg.Content += "\n" + line
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		if err := scanner.Err(); err != nil {
+			yield(domain.Message{}, err)
+			return
+		}
+		flush()
 	}
+}
+
+// complete classifies a message once all its lines have been read.
+func (s *source) complete(msg *domain.Message, line int, report func(Diagnostic)) {
+	applyState(msg)
+	parseStructured(msg)
+	classifyEvent(msg)
 
-	return messages, nil
+	if msg.MediaRef == "" {
+		return
+	}
+	if _, err := fs.Stat(s.fsys, msg.MediaRef); err != nil {
+		msg.MediaMissing = true
+		report(Diagnostic{Line: line, Reason: "referenced media not in export", Raw: msg.MediaRef})
+	}
+	if msg.Type == domain.ContactMessage {
+		msg.Contact = readContact(s.fsys, msg.MediaRef)
+	}
 }
 
-func parseMessageLine(line string) (domain.Message, bool) {
-	// Try iOS format first: [DD.MM.YY(YY), HH:MM:SS] Sender: Text
-	if m := iosRe.FindStringSubmatch(line); m != nil {
-		ts, err := parseIOSTimestamp(m[1], m[2])
-		if err != nil {
-			return domain.Message{}, false
-		}
-		content, msgType, mediaRef := classifyContent(m[4])
-		return domain.Message{
-			Timestamp: ts,
-			Sender:    m[3],
-			Content:   content,
-			Type:      msgType,
-			MediaRef:  mediaRef,
-		}, true
+// participants collects the chat's participants from the message headers
+// alone, without assembling the messages.
+func (s *source) participants() ([]string, error) {
+	f, err := s.fsys.Open(s.chatFile)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	// Try Android format: DD.MM.YY, HH:MM - Sender: Text
-	if m := androidRe.FindStringSubmatch(line); m != nil {
-		ts, err := time.Parse("02.01.06, 15:04", m[1]+", "+m[2])
-		if err != nil {
-			return domain.Message{}, false
+	var people participants
+	scanner := newLineScanner(f)
+	for scanner.Scan() {
+		msg, ok, err := parseMessageLine(scanner.Text(), &s.lay, s.loc)
+		if !ok || err != nil {
+			continue
 		}
-		content, msgType, mediaRef := classifyContent(m[4])
-		return domain.Message{
-			Timestamp: ts,
-			Sender:    m[3],
-			Content:   content,
-			Type:      msgType,
-			MediaRef:  mediaRef,
-		}, true
+		people.add(&msg)
 	}
+	return people.names, scanner.Err()
+}
 
-	// Try iOS system message
-	if m := iosSystemRe.FindStringSubmatch(line); m != nil {
-		ts, err := parseIOSTimestamp(m[1], m[2])
-		if err != nil {
-			return domain.Message{}, false
-		}
-		return domain.Message{
-			Timestamp: ts,
-			Content:   m[3],
-			Type:      domain.SystemMessage,
-		}, true
+// parseMessageLine parses a raw message header line. It reports ok=false for
+// continuation lines and an error for headers with an invalid date.
+func parseMessageLine(raw string, lay *layout, loc *time.Location) (domain.Message, bool, error) {
+	m := lay.re.FindStringSubmatch(stripInvisible(raw))
+	if m == nil {
+		return domain.Message{}, false, nil
+	}
+	ts, err := lay.timestamp(m, loc)
+	if err != nil {
+		return domain.Message{}, false, err
 	}
 
-	// Try Android system message
-	if m := androidSystemRe.FindStringSubmatch(line); m != nil {
-		ts, err := time.Parse("02.01.06, 15:04", m[1]+", "+m[2])
-		if err != nil {
-			return domain.Message{}, false
+	// Regular message: Sender: Text
+	if sm := senderRe.FindStringSubmatch(m[subRest]); sm != nil {
+		content, msgType, mediaRef := classifyContent(sm[2])
+		// iOS exports attribute some system messages to a sender, e.g.
+		// "Anna: ‎Verpasster Sprachanruf", or in groups to the group,
+		// e.g. "Familie: ‎Anna hat Bob hinzugefügt.", and mark them with
+		// U+200E.
+		if msgType == domain.TextMessage && systemMarked(raw) && isEvent(content) {
+			msgType = domain.SystemMessage
 		}
 		return domain.Message{
 			Timestamp: ts,
-			Content:   m[3],
-			Type:      domain.SystemMessage,
-		}, true
+			Sender:    sm[1],
+			Content:   content,
+			Type:      msgType,
+			MediaRef:  mediaRef,
+		}, true, nil
 	}
 
-	return domain.Message{}, false
+	// System message (no sender)
+	return domain.Message{
+		Timestamp: ts,
+		Content:   m[subRest],
+		Type:      domain.SystemMessage,
+	}, true, nil
 }
 
-func parseIOSTimestamp(datePart, timePart string) (time.Time, error) {
-	// Try 2-digit year first (DD.MM.YY), then 4-digit (DD.MM.YYYY)
-	if ts, err := time.Parse("02.01.06, 15:04:05", datePart+", "+timePart); err == nil {
-		return ts, nil
-	}
-	return time.Parse("02.01.2006, 15:04:05", datePart+", "+timePart)
+// systemMarked reports whether the content after the sender starts with the
+// LTR mark iOS puts in front of system messages and attachments.
+func systemMarked(raw string) bool {
+	_, content, ok := strings.Cut(raw, ": ")
+	return ok && strings.HasPrefix(content, "\u200e")
 }
 
 func classifyContent(content string) (string, domain.MessageType, string) {
@@ -280,6 +478,15 @@ func classifyMediaFile(filename string) (string, domain.MessageType, string) {
 	if isVoiceMessage(filename) {
 		return filename, domain.VoiceMessage, filename
 	}
+	if isContactCard(filename) {
+		return filename, domain.ContactMessage, filename
+	}
+	if isSticker(filename) {
+		return filename, domain.StickerMessage, filename
+	}
+	if isGIF(filename) {
+		return filename, domain.GIFMessage, filename
+	}
 	if isImageMessage(filename) {
 		return filename, domain.ImageMessage, filename
 	}
@@ -300,6 +507,23 @@ func isVoiceMessage(s string) bool {
 		strings.HasSuffix(lower, ".ogg")
 }
 
+func isContactCard(s string) bool {
+	return strings.HasSuffix(strings.ToLower(s), ".vcf")
+}
+
+func isSticker(s string) bool {
+	upper := strings.ToUpper(s)
+	return strings.HasPrefix(upper, "STK-") ||
+		strings.Contains(upper, "-STICKER-") ||
+		strings.HasSuffix(upper, ".WEBP")
+}
+
+func isGIF(s string) bool {
+	upper := strings.ToUpper(s)
+	return strings.Contains(upper, "-GIF-") ||
+		strings.HasSuffix(upper, ".GIF")
+}
+
 func isImageMessage(s string) bool {
 	upper := strings.ToUpper(s)
 	return strings.HasPrefix(upper, "IMG-") ||
@@ -0,0 +1,387 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+type wantMessage struct {
+	time   string // "15.01.2024 09:12:03"
+	sender string
+	typ    domain.MessageType
+}
+
+func TestParseFixtures(t *testing.T) {
+	const (
+		text   = domain.TextMessage
+		voice  = domain.VoiceMessage
+		image  = domain.ImageMessage
+		system = domain.SystemMessage
+	)
+
+	tests := []struct {
+		file         string
+		platform     string
+		locale       string
+		dateOrder    string
+		participants []string
+		messages     []wantMessage
+	}{
+		{
+			file: "de_android.txt", platform: "Android", locale: "de", dateOrder: "DD/MM/YY",
+			participants: []string{"Anna Schmidt", "Max Müller"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Anna Schmidt", text},
+				{"15.01.2024 09:13:00", "Max Müller", text},
+				{"15.01.2024 09:15:00", "Anna Schmidt", voice},
+				{"15.01.2024 09:16:00", "Max Müller", image},
+			},
+		},
+		{
+			file: "de_ios.txt", platform: "iOS", locale: "de", dateOrder: "DD/MM/YY",
+			participants: []string{"Anna Schmidt", "Max Müller"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Anna Schmidt", system},
+				{"15.01.2024 09:12:03", "Anna Schmidt", text},
+				{"15.01.2024 09:13:41", "Max Müller", text},
+				{"15.01.2024 09:15:00", "Anna Schmidt", voice},
+				{"15.01.2024 09:16:22", "Max Müller", image},
+			},
+		},
+		{
+			file: "en-GB_android.txt", platform: "Android", locale: "en-GB", dateOrder: "DD/MM/YY",
+			participants: []string{"Anna Smith", "Max Miller"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Anna Smith", text},
+				{"15.01.2024 09:13:00", "Max Miller", text},
+				{"15.01.2024 13:15:00", "Anna Smith", voice},
+				{"15.01.2024 13:16:00", "Max Miller", image},
+			},
+		},
+		{
+			file: "en-GB_ios.txt", platform: "iOS", locale: "en-GB", dateOrder: "DD/MM/YY",
+			participants: []string{"Anna Smith", "Max Miller"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Anna Smith", system},
+				{"15.01.2024 09:12:03", "Anna Smith", text},
+				{"15.01.2024 09:13:41", "Max Miller", text},
+				{"15.01.2024 13:15:00", "Anna Smith", voice},
+				{"15.01.2024 13:16:22", "Max Miller", image},
+			},
+		},
+		{
+			file: "en-US_android.txt", platform: "Android", locale: "en-US", dateOrder: "MM/DD/YY",
+			participants: []string{"Anna Smith", "Max Miller"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Anna Smith", text},
+				{"15.01.2024 12:13:00", "Max Miller", text},
+				{"15.01.2024 13:15:00", "Anna Smith", voice},
+				{"15.01.2024 13:16:00", "Max Miller", image},
+			},
+		},
+		{
+			file: "en-US_ios.txt", platform: "iOS", locale: "en-US", dateOrder: "MM/DD/YY",
+			participants: []string{"Anna Smith", "Max Miller"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Anna Smith", system},
+				{"15.01.2024 09:12:03", "Anna Smith", text},
+				{"15.01.2024 12:13:41", "Max Miller", text},
+				{"15.01.2024 13:15:00", "Anna Smith", voice},
+				{"15.01.2024 13:16:22", "Max Miller", image},
+			},
+		},
+		{
+			file: "es_android.txt", platform: "Android", locale: "es", dateOrder: "DD/MM/YY",
+			participants: []string{"Ana García", "Marcos López"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Ana García", text},
+				{"15.01.2024 12:13:00", "Marcos López", text},
+				{"15.01.2024 13:15:00", "Ana García", voice},
+			},
+		},
+		{
+			file: "es_ios.txt", platform: "iOS", locale: "es", dateOrder: "DD/MM/YY",
+			participants: []string{"Ana García", "Marcos López"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Ana García", system},
+				{"15.01.2024 09:12:03", "Ana García", text},
+				{"15.01.2024 09:13:41", "Marcos López", text},
+				{"15.01.2024 13:15:00", "Ana García", voice},
+			},
+		},
+		{
+			file: "fr_android.txt", platform: "Android", locale: "fr", dateOrder: "DD/MM/YY",
+			participants: []string{"Anne Martin", "Marc Dubois"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Anne Martin", text},
+				{"15.01.2024 09:13:00", "Marc Dubois", text},
+				{"15.01.2024 13:15:00", "Anne Martin", voice},
+			},
+		},
+		{
+			file: "fr_ios.txt", platform: "iOS", locale: "fr", dateOrder: "DD/MM/YY",
+			participants: []string{"Anne Martin", "Marc Dubois"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Anne Martin", system},
+				{"15.01.2024 09:12:03", "Anne Martin", text},
+				{"15.01.2024 09:13:41", "Marc Dubois", text},
+				{"15.01.2024 13:15:00", "Anne Martin", voice},
+			},
+		},
+		{
+			file: "it_android.txt", platform: "Android", locale: "it", dateOrder: "DD/MM/YY",
+			participants: []string{"Giulia Rossi", "Marco Bianchi"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Giulia Rossi", text},
+				{"15.01.2024 09:13:00", "Marco Bianchi", text},
+				{"15.01.2024 13:15:00", "Giulia Rossi", voice},
+				{"15.01.2024 13:16:00", "Marco Bianchi", image},
+			},
+		},
+		{
+			file: "it_ios.txt", platform: "iOS", locale: "it", dateOrder: "DD/MM/YY",
+			participants: []string{"Giulia Rossi", "Marco Bianchi"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Giulia Rossi", system},
+				{"15.01.2024 09:12:03", "Giulia Rossi", text},
+				{"15.01.2024 09:13:41", "Marco Bianchi", text},
+				{"15.01.2024 13:15:00", "Giulia Rossi", voice},
+				{"15.01.2024 13:16:22", "Marco Bianchi", image},
+			},
+		},
+		{
+			file: "pt_android.txt", platform: "Android", locale: "pt", dateOrder: "DD/MM/YY",
+			participants: []string{"Ana Souza", "Pedro Lima"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Ana Souza", text},
+				{"15.01.2024 09:13:00", "Pedro Lima", text},
+				{"15.01.2024 13:15:00", "Ana Souza", voice},
+				{"15.01.2024 13:16:00", "Pedro Lima", image},
+			},
+		},
+		{
+			file: "pt_ios.txt", platform: "iOS", locale: "pt", dateOrder: "DD/MM/YY",
+			participants: []string{"Ana Souza", "Pedro Lima"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Ana Souza", system},
+				{"15.01.2024 09:12:03", "Ana Souza", text},
+				{"15.01.2024 09:13:41", "Pedro Lima", text},
+				{"15.01.2024 13:15:00", "Ana Souza", voice},
+				{"15.01.2024 13:16:22", "Pedro Lima", image},
+			},
+		},
+		{
+			file: "nl_android.txt", platform: "Android", locale: "nl", dateOrder: "DD/MM/YY",
+			participants: []string{"Anna de Vries", "Max Jansen"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:00", "", system},
+				{"15.01.2024 09:12:00", "Anna de Vries", text},
+				{"15.01.2024 09:13:00", "Max Jansen", text},
+				{"15.01.2024 13:15:00", "Anna de Vries", voice},
+				{"15.01.2024 13:16:00", "Max Jansen", image},
+			},
+		},
+		{
+			file: "nl_ios.txt", platform: "iOS", locale: "nl", dateOrder: "DD/MM/YY",
+			participants: []string{"Anna de Vries", "Max Jansen"},
+			messages: []wantMessage{
+				{"15.01.2024 09:12:03", "Anna de Vries", system},
+				{"15.01.2024 09:12:03", "Anna de Vries", text},
+				{"15.01.2024 09:13:41", "Max Jansen", text},
+				{"15.01.2024 13:15:00", "Anna de Vries", voice},
+				{"15.01.2024 13:16:22", "Max Jansen", image},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			p := &WhatsAppParser{Location: time.UTC}
+			defer p.Cleanup()
+
+			chat, err := p.Parse(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+
+			det := p.Detection
+			if det.Platform != tt.platform || det.Locale != tt.locale || det.DateOrder != tt.dateOrder {
+				t.Errorf("detected %s/%s/%s, want %s/%s/%s",
+					det.Platform, det.Locale, det.DateOrder, tt.platform, tt.locale, tt.dateOrder)
+			}
+			if det.Ambiguous {
+				t.Errorf("detection is ambiguous")
+			}
+			if !slices.Equal(chat.Meta.Participants, tt.participants) {
+				t.Errorf("participants = %q, want %q", chat.Meta.Participants, tt.participants)
+			}
+
+			if len(chat.Messages) != len(tt.messages) {
+				t.Fatalf("got %d messages, want %d", len(chat.Messages), len(tt.messages))
+			}
+			for i, want := range tt.messages {
+				got := chat.Messages[i]
+				wantTime, err := time.ParseInLocation("02.01.2006 15:04:05", want.time, time.UTC)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !got.Timestamp.Equal(wantTime) {
+					t.Errorf("message %d: timestamp = %s, want %s", i, got.Timestamp, wantTime)
+				}
+				if got.Sender != want.sender {
+					t.Errorf("message %d: sender = %q, want %q", i, got.Sender, want.sender)
+				}
+				if got.Type != want.typ {
+					t.Errorf("message %d: type = %d, want %d", i, got.Type, want.typ)
+				}
+			}
+
+			// The first message of every fixture is the encryption notice.
+			if ev := chat.Messages[0].Event; ev == nil || ev.Kind != domain.EventEncryptionNotice {
+				t.Errorf("first message: event = %v, want encryption notice", ev)
+			}
+		})
+	}
+}
+
+func TestParseGroupSystemMessages(t *testing.T) {
+	// iOS exports attribute system messages to a sender or, in groups, to
+	// the group and mark their content with U+200E, like attachments.
+	const chatText = "[15.01.24, 09:12:03] Familie: \u200eNachrichten und Anrufe sind Ende-zu-Ende-verschlüsselt.\n" +
+		"[15.01.24, 09:12:04] Familie: \u200eAnna hat Ben hinzugefügt.\n" +
+		"[15.01.24, 09:13:00] Anna: \u200e<Anhang: 00000012-PHOTO-2024-01-15-09-13-00.jpg>\n" +
+		"[15.01.24, 09:14:00] Ben: Hallo, Anna hat Ben hinzugefügt.\n" +
+		"[15.01.24, 09:15:00] Anna: \u200eVerpasster Sprachanruf\n" +
+		"[15.01.24, 09:16:00] Ben: Verpasster Sprachanruf von Carla, ruf sie zurück\n"
+
+	path := filepath.Join(t.TempDir(), "_chat.txt")
+	if err := os.WriteFile(path, []byte(chatText), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &WhatsAppParser{Location: time.UTC}
+	defer p.Cleanup()
+
+	chat, err := p.Parse(path)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if want := []string{"Anna", "Ben"}; !slices.Equal(chat.Meta.Participants, want) {
+		t.Errorf("participants = %q, want %q", chat.Meta.Participants, want)
+	}
+	if len(chat.Messages) != 6 {
+		t.Fatalf("got %d messages, want 6", len(chat.Messages))
+	}
+
+	added := chat.Messages[1]
+	if added.Type != domain.SystemMessage || added.Event == nil || added.Event.Kind != domain.EventMemberAdded {
+		t.Fatalf("message 1: type %d, event %v, want member added", added.Type, added.Event)
+	}
+	if added.Event.Actor != "Anna" || !slices.Equal(added.Event.Participants, []string{"Ben"}) {
+		t.Errorf("message 1: actor %q, participants %q, want Anna, [Ben]", added.Event.Actor, added.Event.Participants)
+	}
+	if typ := chat.Messages[2].Type; typ != domain.ImageMessage {
+		t.Errorf("message 2: type = %d, want image", typ)
+	}
+	if typ := chat.Messages[3].Type; typ != domain.TextMessage {
+		t.Errorf("message 3: type = %d, want text", typ)
+	}
+	if call := chat.Messages[4]; call.Event == nil || call.Event.Kind != domain.EventMissedVoiceCall {
+		t.Errorf("message 4: type %d, event %v, want missed voice call", call.Type, call.Event)
+	}
+	if typ := chat.Messages[5].Type; typ != domain.TextMessage {
+		t.Errorf("message 5: type = %d, want text", typ)
+	}
+}
+
+func TestStreamStrictFailsUpFront(t *testing.T) {
+	// The fixture references media that is not in testdata.
+	p := &WhatsAppParser{Strict: true}
+	defer p.Cleanup()
+
+	if _, err := p.Stream(filepath.Join("testdata", "de_ios.txt")); err == nil {
+		t.Error("Stream succeeded, want strict mode error")
+	}
+}
+
+func TestDetectIgnoresChatProblems(t *testing.T) {
+	// The fixture references media that is not in testdata, which Parse
+	// reports in strict mode. Detection only reads the format.
+	p := &WhatsAppParser{Strict: true}
+	defer p.Cleanup()
+
+	det, err := p.Detect(filepath.Join("testdata", "de_ios.txt"))
+	if err != nil {
+		t.Fatalf("Detect: %v", err)
+	}
+	if det.Platform != "iOS" || det.Locale != "de" {
+		t.Errorf("detected %s/%s, want iOS/de", det.Platform, det.Locale)
+	}
+}
+
+func TestDetectionsPerExport(t *testing.T) {
+	p := &WhatsAppParser{Location: time.UTC}
+	defer p.Cleanup()
+
+	files := map[string]string{"de_ios.txt": "de", "en-US_android.txt": "en-US"}
+	for file := range files {
+		if _, err := p.Parse(filepath.Join("testdata", file)); err != nil {
+			t.Fatalf("Parse %s: %v", file, err)
+		}
+	}
+
+	for file, locale := range files {
+		det := p.Detections[filepath.Join("testdata", file)]
+		if det == nil || det.Locale != locale {
+			t.Errorf("%s: detection %v, want locale %s", file, det, locale)
+		}
+	}
+}
+
+func TestFindChatFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  string // empty: error
+	}{
+		{"ios", []string{"00000012-notes.txt", "_chat.txt"}, "_chat.txt"},
+		{"android", []string{"00000012-notes.txt", "WhatsApp Chat mit Anna.txt"}, "WhatsApp Chat mit Anna.txt"},
+		{"renamed", []string{"chat.txt", "IMG-20240115-WA0001.jpg"}, "chat.txt"},
+		{"ambiguous", []string{"a.txt", "b.txt"}, ""},
+		{"none", []string{"IMG-20240115-WA0001.jpg"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, f := range tt.files {
+				fsys[f] = &fstest.MapFile{}
+			}
+
+			got, err := findChatFile(fsys)
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("findChatFile = %q, want error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("findChatFile = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+)
+
+// maxEntrySize caps the size of a single file read from a zip export, to
+// guard against decompression bombs (G110).
+const maxEntrySize = 1 << 30
+
+// limitedFS caps the files read from a zip export at max bytes. Files that
+// declare a larger size can't be opened; as the declared size can be
+// forged, reads stop at the cap as well.
+type limitedFS struct {
+	fs.FS
+	max int64
+}
+
+func (l limitedFS) Open(name string) (fs.File, error) {
+	f, err := l.FS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if info.IsDir() {
+		return f, nil
+	}
+	if info.Size() > l.max {
+		_ = f.Close()
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fmt.Errorf("larger than %d bytes", l.max)}
+	}
+	return &limitedFile{File: f, r: io.LimitReader(f, l.max)}, nil
+}
+
+type limitedFile struct {
+	fs.File
+	r io.Reader
+}
+
+func (f *limitedFile) Read(p []byte) (int, error) {
+	return f.r.Read(p)
+}
@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/fs"
+	"testing"
+)
+
+func TestLimitedFS(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{"_chat.txt": "small", "PTT-20240115-WA0001.opus": "far too large"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := limitedFS{FS: zr, max: 8}
+	if data, err := fs.ReadFile(fsys, "_chat.txt"); err != nil || string(data) != "small" {
+		t.Errorf("ReadFile(_chat.txt) = %q, %v, want \"small\"", data, err)
+	}
+	if _, err := fsys.Open("PTT-20240115-WA0001.opus"); err == nil {
+		t.Error("Open of an entry above the cap succeeded, want error")
+	}
+	if name, err := findChatFile(fsys); err != nil || name != "_chat.txt" {
+		t.Errorf("findChatFile = %q, %v, want _chat.txt", name, err)
+	}
+}
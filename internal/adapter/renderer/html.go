@@ -0,0 +1,119 @@
+package renderer
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// HTMLRenderer renders a chat as an HTML page. Voice messages get an audio
+// player, and the segments of their transcripts link to their position in
+// it. Other messages are rendered as by the embedded TextRenderer.
+//
+// The page is written as a stream, so it ends without closing tags, which
+// HTML allows. More messages can thus be appended to it later.
+type HTMLRenderer struct {
+	*TextRenderer
+	// MediaBase is the directory the audio players load the attachments
+	// from, e.g. that of an extracted export. Empty means the directory of
+	// the page.
+	MediaBase string
+}
+
+// htmlHead styles the page and makes the segment links seek the audio
+// player of their voice message.
+const htmlHead = `<meta charset="utf-8">
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; line-height: 1.4; }
+.voice audio { display: block; margin: .3em 0; }
+.transcript a { color: #666; font-size: .85em; text-decoration: none; }
+</style>
+<script>
+document.addEventListener("click", e => {
+  const link = e.target.closest("a.seek");
+  if (!link) return;
+  e.preventDefault();
+  const audio = link.closest(".voice").querySelector("audio");
+  audio.currentTime = link.dataset.start;
+  audio.play();
+});
+</script>
+`
+
+func (r *HTMLRenderer) RenderHeader(w io.Writer, meta *domain.Metadata) error {
+	if r.NoHeader {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n")
+	if meta.Locale != "" {
+		fmt.Fprintf(&b, "<html lang=\"%s\">\n", html.EscapeString(meta.Locale))
+	} else {
+		b.WriteString("<html>\n")
+	}
+	b.WriteString("<head>\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n", html.EscapeString(meta.Title))
+	b.WriteString(htmlHead)
+	b.WriteString("</head>\n<body>\n<header>\n")
+	for line := range strings.Lines(strings.TrimSpace(r.formatHeader(meta))) {
+		fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(strings.TrimSpace(line)))
+	}
+	b.WriteString("</header>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (r *HTMLRenderer) RenderMessage(w io.Writer, msg *domain.Message) error {
+	if r.hidden(msg) {
+		return nil
+	}
+	if msg.Type != domain.VoiceMessage || msg.Deleted || msg.MediaMissing {
+		_, err := fmt.Fprintf(w, "<p>%s</p>\n", htmlLines(r.formatMessage(msg)))
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("<div class=\"voice\">\n")
+	fmt.Fprintf(&b, "<p>[%s] %s: [Sprachnachricht]</p>\n",
+		html.EscapeString(r.formatTime(msg.Timestamp)), html.EscapeString(msg.Sender))
+	fmt.Fprintf(&b, "<audio controls preload=\"none\" src=\"%s\"></audio>\n", html.EscapeString(r.mediaURL(msg.MediaRef)))
+
+	switch {
+	case msg.Transcript != nil && len(msg.Transcript.Segments) > 0:
+		b.WriteString("<p class=\"transcript\">")
+		for i, seg := range msg.Transcript.Segments {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "<a class=\"seek\" href=\"#\" data-start=\"%.2f\">[%s]</a> %s",
+				seg.Start.Seconds(), formatOffset(seg.Start), html.EscapeString(seg.Text))
+		}
+		b.WriteString("</p>\n")
+	case msg.Content != "" && msg.Content != msg.MediaRef:
+		fmt.Fprintf(&b, "<p class=\"transcript\">%s</p>\n", htmlLines(msg.Content))
+	}
+	b.WriteString("</div>\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (r *HTMLRenderer) mediaURL(ref string) string {
+	u := url.URL{Path: ref}
+	if r.MediaBase != "" {
+		u.Path = path.Join(r.MediaBase, ref)
+	}
+	return u.EscapedPath()
+}
+
+// htmlLines escapes s and keeps its line breaks.
+func htmlLines(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>\n")
+}
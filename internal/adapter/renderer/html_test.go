@@ -0,0 +1,107 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+func TestHTMLHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		meta domain.Metadata
+		want []string
+	}{
+		{
+			name: "locale",
+			meta: domain.Metadata{Title: "Anna & Ben", Locale: "it"},
+			want: []string{`<html lang="it">`, "<title>Anna &amp; Ben</title>", "<p>Chat: Anna &amp; Ben</p>"},
+		},
+		{
+			name: "unknown locale",
+			meta: domain.Metadata{Title: "<script>"},
+			want: []string{"<html>\n", "<title>&lt;script&gt;</title>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			r := &HTMLRenderer{TextRenderer: &TextRenderer{}}
+			if err := r.RenderHeader(&b, &tt.meta); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(b.String(), want) {
+					t.Errorf("header lacks %q:\n%s", want, b.String())
+				}
+			}
+		})
+	}
+}
+
+func TestHTMLMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		mediaBase string
+		msg       domain.Message
+		want      string
+	}{
+		{
+			name: "text",
+			msg:  domain.Message{Content: "<b>Tom & Jerry</b>\nzweite Zeile"},
+			want: "<p>[15.01.2024 09:15] Anna: &lt;b&gt;Tom &amp; Jerry&lt;/b&gt;<br>\nzweite Zeile</p>\n",
+		},
+		{
+			name: "segments",
+			msg: domain.Message{Type: domain.VoiceMessage, MediaRef: "PTT-20240115-WA0001.opus",
+				Content: "Hallo <Ben>. Bis dann.",
+				Transcript: &domain.Transcript{Segments: []domain.Segment{
+					{Start: 0, End: 4 * time.Second, Text: "Hallo <Ben>."},
+					{Start: 62500 * time.Millisecond, End: 65 * time.Second, Text: "Bis dann."},
+				}}},
+			want: `<div class="voice">
+<p>[15.01.2024 09:15] Anna: [Sprachnachricht]</p>
+<audio controls preload="none" src="PTT-20240115-WA0001.opus"></audio>
+<p class="transcript"><a class="seek" href="#" data-start="0.00">[0:00]</a> Hallo &lt;Ben&gt;. <a class="seek" href="#" data-start="62.50">[1:02]</a> Bis dann.</p>
+</div>
+`,
+		},
+		{
+			name:      "media base with spaces",
+			mediaBase: "WhatsApp Chat - Anna",
+			msg:       domain.Message{Type: domain.VoiceMessage, MediaRef: "Audio #1.opus", Content: "Hallo & tschüss"},
+			want: `<div class="voice">
+<p>[15.01.2024 09:15] Anna: [Sprachnachricht]</p>
+<audio controls preload="none" src="WhatsApp%20Chat%20-%20Anna/Audio%20%231.opus"></audio>
+<p class="transcript">Hallo &amp; tschüss</p>
+</div>
+`,
+		},
+		{
+			name: "not transcribed",
+			msg:  domain.Message{Type: domain.VoiceMessage, MediaRef: "PTT-20240115-WA0001.opus", Content: "PTT-20240115-WA0001.opus"},
+			want: `<div class="voice">
+<p>[15.01.2024 09:15] Anna: [Sprachnachricht]</p>
+<audio controls preload="none" src="PTT-20240115-WA0001.opus"></audio>
+</div>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.Timestamp, tt.msg.Sender = testTime, "Anna"
+			r := &HTMLRenderer{TextRenderer: &TextRenderer{}, MediaBase: tt.mediaBase}
+			var b strings.Builder
+			if err := r.RenderMessage(&b, &tt.msg); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
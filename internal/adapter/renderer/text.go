@@ -3,6 +3,9 @@ package renderer
 import (
 	"fmt"
 	"io"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/joern1811/wachat/internal/domain"
 )
@@ -10,46 +13,234 @@ import (
 // TextRenderer renders a chat as plain text.
 type TextRenderer struct {
 	Markdown bool
+	// Location is the time zone timestamps are shown in. nil keeps the
+	// zone of the parsed timestamps.
+	Location *time.Location
+	// HideDeleted omits messages that were deleted by their sender.
+	HideDeleted bool
+	// HideEvents omits system messages of the given kinds.
+	HideEvents []domain.SystemEventKind
+	// NoHeader leaves out the chat header, e.g. when appending to an
+	// existing output file.
+	NoHeader bool
+	// Timestamps marks the segments of voice message transcripts with
+	// their position in the audio, e.g. "[0:42]".
+	Timestamps bool
 }
 
-func (r *TextRenderer) Render(w io.Writer, chat *domain.Chat) error {
-	for i := range chat.Messages {
-		line := r.formatMessage(&chat.Messages[i])
-		if _, err := fmt.Fprintln(w, line); err != nil {
-			return err
+func (r *TextRenderer) RenderHeader(w io.Writer, meta *domain.Metadata) error {
+	if r.NoHeader {
+		return nil
+	}
+	_, err := io.WriteString(w, r.formatHeader(meta))
+	return err
+}
+
+func (r *TextRenderer) RenderMessage(w io.Writer, msg *domain.Message) error {
+	if r.hidden(msg) {
+		return nil
+	}
+	_, err := fmt.Fprintln(w, r.formatMessage(msg))
+	return err
+}
+
+// formatHeader describes the chat and its export so output files are
+// self-describing. Unknown fields are left out.
+func (r *TextRenderer) formatHeader(meta *domain.Metadata) string {
+	var fields [][2]string
+	if len(meta.Participants) > 0 {
+		fields = append(fields, [2]string{"Teilnehmer", strings.Join(meta.Participants, ", ")})
+	}
+
+	var origin []string
+	if meta.Platform != "" {
+		origin = append(origin, meta.Platform)
+	}
+	if meta.Locale != "" {
+		origin = append(origin, meta.Locale)
+	}
+	if !meta.ExportedAt.IsZero() {
+		origin = append(origin, "exportiert am "+r.formatTime(meta.ExportedAt))
+	}
+	if len(origin) > 0 {
+		fields = append(fields, [2]string{"Export", strings.Join(origin, ", ")})
+	}
+
+	if meta.Title == "" && len(fields) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	if r.Markdown {
+		if meta.Title != "" {
+			fmt.Fprintf(&b, "# %s\n\n", meta.Title)
 		}
+		for _, f := range fields {
+			fmt.Fprintf(&b, "- **%s:** %s\n", f[0], f[1])
+		}
+	} else {
+		if meta.Title != "" {
+			fmt.Fprintf(&b, "Chat: %s\n", meta.Title)
+		}
+		for _, f := range fields {
+			fmt.Fprintf(&b, "%s: %s\n", f[0], f[1])
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+func (r *TextRenderer) formatTime(t time.Time) string {
+	if r.Location != nil {
+		t = t.In(r.Location)
+	}
+	return t.Format("02.01.2006 15:04")
+}
+
+func (r *TextRenderer) hidden(msg *domain.Message) bool {
+	if r.HideDeleted && msg.Deleted {
+		return true
 	}
-	return nil
+	return msg.Event != nil && slices.Contains(r.HideEvents, msg.Event.Kind)
 }
 
 func (r *TextRenderer) formatMessage(msg *domain.Message) string {
-	ts := msg.Timestamp.Format("02.01.2006 15:04")
+	line := r.formatBody(msg)
+	if msg.Edited {
+		line += " (bearbeitet)"
+	}
+	return line
+}
+
+func (r *TextRenderer) formatBody(msg *domain.Message) string {
+	ts := r.formatTime(msg.Timestamp)
+
+	switch {
+	case msg.Deleted:
+		return fmt.Sprintf("[%s] %s: [Nachricht gelöscht]", ts, msg.Sender)
+	case msg.ViewOnce:
+		return fmt.Sprintf("[%s] %s: [Einmalansicht, nicht exportiert]", ts, msg.Sender)
+	case msg.MediaMissing && msg.Contact == nil:
+		return fmt.Sprintf("[%s] %s: %s", ts, msg.Sender, formatMissingMedia(msg))
+	}
 
 	switch msg.Type {
 	case domain.SystemMessage:
+		content := msg.Content
+		if msg.Sender != "" {
+			content = msg.Sender + ": " + content
+		}
 		if r.Markdown {
-			return fmt.Sprintf("*[%s] %s*", ts, msg.Content)
+			return fmt.Sprintf("*[%s] %s*", ts, content)
 		}
-		return fmt.Sprintf("*** [%s] %s", ts, msg.Content)
+		return fmt.Sprintf("*** [%s] %s", ts, content)
 
 	case domain.VoiceMessage:
 		prefix := "[Sprachnachricht]"
 		content := msg.Content
 		if content == "" || content == msg.MediaRef {
 			content = msg.MediaRef
+		} else if r.Timestamps && msg.Transcript != nil && len(msg.Transcript.Segments) > 0 {
+			content = formatSegments(msg.Transcript.Segments)
 		}
 		return fmt.Sprintf("[%s] %s: %s %s", ts, msg.Sender, prefix, content)
 
-	case domain.ImageMessage:
-		return fmt.Sprintf("[%s] %s: [Bild] %s", ts, msg.Sender, msg.MediaRef)
+	case domain.ImageMessage, domain.VideoMessage, domain.DocumentMessage, domain.StickerMessage, domain.GIFMessage:
+		return fmt.Sprintf("[%s] %s: [%s] %s", ts, msg.Sender, mediaLabels[msg.Type], msg.MediaRef)
+
+	case domain.ContactMessage:
+		// The name of a missing contact card is still known from its
+		// file name.
+		line := fmt.Sprintf("[%s] %s: [Kontakt] %s", ts, msg.Sender, formatContact(msg))
+		if msg.MediaMissing {
+			line += " (nicht im Export enthalten)"
+		}
+		return line
 
-	case domain.VideoMessage:
-		return fmt.Sprintf("[%s] %s: [Video] %s", ts, msg.Sender, msg.MediaRef)
+	case domain.LocationMessage:
+		return fmt.Sprintf("[%s] %s: %s", ts, msg.Sender, formatLocation(msg.Location))
 
-	case domain.DocumentMessage:
-		return fmt.Sprintf("[%s] %s: [Dokument] %s", ts, msg.Sender, msg.MediaRef)
+	case domain.PollMessage:
+		return fmt.Sprintf("[%s] %s: [Umfrage] %s", ts, msg.Sender, formatPoll(msg.Poll))
 
 	default:
 		return fmt.Sprintf("[%s] %s: %s", ts, msg.Sender, msg.Content)
 	}
 }
+
+// formatSegments joins the segments of a transcript, each preceded by its
+// start offset.
+func formatSegments(segs []domain.Segment) string {
+	parts := make([]string, len(segs))
+	for i, seg := range segs {
+		parts[i] = fmt.Sprintf("[%s] %s", formatOffset(seg.Start), seg.Text)
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatOffset formats a position in audio as "m:ss", or "h:mm:ss" from
+// an hour on.
+func formatOffset(d time.Duration) string {
+	secs := int(d / time.Second)
+	if secs >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", secs/3600, secs/60%60, secs%60)
+	}
+	return fmt.Sprintf("%d:%02d", secs/60, secs%60)
+}
+
+var mediaLabels = map[domain.MessageType]string{
+	domain.VoiceMessage:    "Sprachnachricht",
+	domain.ImageMessage:    "Bild",
+	domain.VideoMessage:    "Video",
+	domain.DocumentMessage: "Dokument",
+	domain.StickerMessage:  "Sticker",
+	domain.GIFMessage:      "GIF",
+	domain.ContactMessage:  "Kontakt",
+}
+
+func formatMissingMedia(msg *domain.Message) string {
+	label, ok := mediaLabels[msg.Type]
+	if !ok {
+		return "[Medien nicht im Export enthalten]"
+	}
+	if msg.MediaRef == "" {
+		return fmt.Sprintf("[%s] (nicht im Export enthalten)", label)
+	}
+	return fmt.Sprintf("[%s] %s (nicht im Export enthalten)", label, msg.MediaRef)
+}
+
+func formatContact(msg *domain.Message) string {
+	if msg.Contact == nil {
+		return msg.MediaRef
+	}
+	if len(msg.Contact.Numbers) == 0 {
+		return msg.Contact.Name
+	}
+	return fmt.Sprintf("%s (%s)", msg.Contact.Name, strings.Join(msg.Contact.Numbers, ", "))
+}
+
+func formatLocation(loc *domain.Location) string {
+	switch {
+	case loc == nil:
+		return "[Standort]"
+	case loc.Live:
+		return "[Live-Standort]"
+	case loc.Latitude == 0 && loc.Longitude == 0:
+		return "[Standort] " + loc.URL
+	default:
+		return fmt.Sprintf("[Standort] %.6f, %.6f (%s)", loc.Latitude, loc.Longitude, loc.URL)
+	}
+}
+
+func formatPoll(poll *domain.Poll) string {
+	var b strings.Builder
+	b.WriteString(poll.Question)
+	for _, opt := range poll.Options {
+		label := "Stimmen"
+		if opt.Votes == 1 {
+			label = "Stimme"
+		}
+		fmt.Fprintf(&b, "\n  - %s (%d %s)", opt.Text, opt.Votes, label)
+	}
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package renderer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+var testTime = time.Date(2024, 1, 15, 9, 15, 0, 0, time.UTC)
+
+func TestFormatMissingMedia(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  domain.Message
+		want string
+	}{
+		{
+			name: "voice",
+			msg:  domain.Message{Type: domain.VoiceMessage, MediaRef: "PTT-20240115-WA0001.opus", MediaMissing: true},
+			want: "[15.01.2024 09:15] Anna: [Sprachnachricht] PTT-20240115-WA0001.opus (nicht im Export enthalten)",
+		},
+		{
+			name: "contact",
+			msg: domain.Message{Type: domain.ContactMessage, MediaRef: "00000005-Max.vcf", MediaMissing: true,
+				Contact: &domain.Contact{Name: "Max"}},
+			want: "[15.01.2024 09:15] Anna: [Kontakt] Max (nicht im Export enthalten)",
+		},
+		{
+			name: "contact in export",
+			msg: domain.Message{Type: domain.ContactMessage, MediaRef: "00000005-Max.vcf",
+				Contact: &domain.Contact{Name: "Max", Numbers: []string{"+49 151 12345678"}}},
+			want: "[15.01.2024 09:15] Anna: [Kontakt] Max (+49 151 12345678)",
+		},
+	}
+
+	r := &TextRenderer{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.Timestamp, tt.msg.Sender = testTime, "Anna"
+			var b strings.Builder
+			if err := r.RenderMessage(&b, &tt.msg); err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.TrimSuffix(b.String(), "\n"); got != tt.want {
+				t.Errorf("got  %q\nwant %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatOffset(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0:00"},
+		{42*time.Second + 900*time.Millisecond, "0:42"},
+		{10*time.Minute + 5*time.Second, "10:05"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+	}
+	for _, tt := range tests {
+		if got := formatOffset(tt.d); got != tt.want {
+			t.Errorf("formatOffset(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
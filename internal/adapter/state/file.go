@@ -0,0 +1,76 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// FileStore keeps one JSON state file per chat in Dir.
+type FileStore struct {
+	Dir string
+}
+
+// ReadOnly wraps a StateStore so that Save does nothing, e.g. for dry runs.
+type ReadOnly struct {
+	domain.StateStore
+}
+
+func (ReadOnly) Save(string, *domain.ProcessState) error { return nil }
+
+func (s *FileStore) Load(chatKey string) (*domain.ProcessState, error) {
+	data, err := os.ReadFile(s.path(chatKey))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var st domain.ProcessState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("reading state %s: %w", s.path(chatKey), err)
+	}
+	return &st, nil
+}
+
+func (s *FileStore) Save(chatKey string, st *domain.ProcessState) error {
+	if err := os.MkdirAll(s.Dir, 0o750); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so an interrupted run can't leave a
+	// truncated state behind.
+	tmp := s.path(chatKey) + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(chatKey))
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// path returns a readable file name for chatKey. A short hash keeps keys
+// apart that only differ in characters replaced by the slug.
+func (s *FileStore) path(chatKey string) string {
+	slug := strings.Trim(unsafeChars.ReplaceAllString(strings.ToLower(chatKey), "-"), "-")
+	if slug == "" {
+		slug = "chat"
+	}
+	sum := sha256.Sum256([]byte(chatKey))
+	return filepath.Join(s.Dir, slug+"-"+hex.EncodeToString(sum[:4])+".json")
+}
@@ -0,0 +1,105 @@
+package transcriber
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/joern1811/wachat/internal/adapter/cache"
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// Cached is a Transcriber that remembers the transcripts of Next, so the
+// same audio is only sent once. Entries are keyed by the SHA-256 of the
+// audio together with Variant, Prompt and the requested language. The
+// request's prompt is not part of the key: the vocabulary added to it is
+// derived from the surrounding chat and only nudges spelling, so it would
+// cause misses for no benefit. Cache failures are not fatal: a broken entry
+// counts as a miss, and a transcript that can't be stored is still returned.
+type Cached struct {
+	Next  domain.Transcriber
+	Store *cache.FileStore
+	// Variant describes the settings of Next that affect transcripts (e.g.
+	// backend, model and language), so changing them doesn't reuse
+	// transcripts made with other settings.
+	Variant string
+	// Prompt is the prompt given by the user, without the vocabulary.
+	// Changing it, e.g. to fix misheard names, transcribes the audio anew.
+	Prompt string
+}
+
+func (c *Cached) Transcribe(ctx context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	audio, err := audioHash(req)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey(c.Variant, c.Prompt, req.Language, audio)
+
+	if e, err := c.Store.Get(key); err == nil && e != nil {
+		return &domain.Transcript{Text: e.Text, Segments: e.Segments, Cached: true}, nil
+	}
+
+	t, err := c.Next.Transcribe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = c.Store.Put(key, &cache.Entry{Text: t.Text, Segments: t.Segments, Source: req.Path, CreatedAt: time.Now()})
+	return t, nil
+}
+
+// ErrNotCached is returned by CacheOnly for audio without a cached
+// transcript.
+var ErrNotCached = errors.New("no cached transcript")
+
+// CacheOnly is a Transcriber that only looks up the transcripts stored by
+// Cached transcribers with any of Variants. At the head of a Fallback chain,
+// it reuses a transcript of any backend before trying them in turn.
+type CacheOnly struct {
+	Store    *cache.FileStore
+	Variants []string
+	// Prompt is the user's prompt, as in Cached.
+	Prompt string
+}
+
+func (c *CacheOnly) Transcribe(_ context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	audio, err := audioHash(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, variant := range c.Variants {
+		if e, err := c.Store.Get(cacheKey(variant, c.Prompt, req.Language, audio)); err == nil && e != nil {
+			return &domain.Transcript{Text: e.Text, Segments: e.Segments, Cached: true}, nil
+		}
+	}
+	return nil, ErrNotCached
+}
+
+// audioHash returns the SHA-256 of the requested audio file.
+func audioHash(req domain.TranscriptionRequest) ([]byte, error) {
+	f, err := req.Media.Open(req.Path)
+	if err != nil {
+		return nil, fmt.Errorf("opening audio file %s: %w", req.Path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("reading audio file %s: %w", req.Path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+func cacheKey(variant, prompt, language string, audio []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%x", variant, language, audio)
+	// Keys without a prompt stay as they were before it was included.
+	if prompt != "" {
+		fmt.Fprintf(h, "\x00%s", prompt)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,63 @@
+package transcriber
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/joern1811/wachat/internal/adapter/cache"
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// countingTranscriber returns err, or else a fixed transcript, and counts
+// its calls.
+type countingTranscriber struct {
+	calls int
+	err   error
+}
+
+func (c *countingTranscriber) Transcribe(context.Context, domain.TranscriptionRequest) (*domain.Transcript, error) {
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &domain.Transcript{Text: "Hallo"}, nil
+}
+
+func TestCachedPrompt(t *testing.T) {
+	store := &cache.FileStore{Dir: t.TempDir()}
+	next := &countingTranscriber{}
+	media := fstest.MapFS{"PTT-20240115-WA0001.opus": &fstest.MapFile{Data: []byte("OggS")}}
+	req := func(prompt string) domain.TranscriptionRequest {
+		return domain.TranscriptionRequest{Media: media, Path: "PTT-20240115-WA0001.opus", Prompt: prompt}
+	}
+
+	steps := []struct {
+		name       string
+		userPrompt string
+		reqPrompt  string // with vocabulary
+		wantCalls  int
+	}{
+		{"first", "Anna, Ben", "Anna, Ben. Berlin", 1},
+		{"other vocabulary", "Anna, Ben", "Anna, Ben. Hamburg", 1},
+		{"changed prompt", "Anna, Benedikt", "Anna, Benedikt. Hamburg", 2},
+	}
+	for _, step := range steps {
+		c := &Cached{Next: next, Store: store, Variant: "test", Prompt: step.userPrompt}
+		if _, err := c.Transcribe(context.Background(), req(step.reqPrompt)); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if next.calls != step.wantCalls {
+			t.Errorf("%s: %d calls, want %d", step.name, next.calls, step.wantCalls)
+		}
+	}
+
+	only := &CacheOnly{Store: store, Variants: []string{"test"}, Prompt: "Anna, Ben"}
+	if _, err := only.Transcribe(context.Background(), req("")); err != nil {
+		t.Errorf("CacheOnly with the first prompt: %v", err)
+	}
+	only.Prompt = "Carla"
+	if _, err := only.Transcribe(context.Background(), req("")); err == nil {
+		t.Error("CacheOnly with an unused prompt found a transcript")
+	}
+}
@@ -0,0 +1,184 @@
+package transcriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/openai/openai-go/v3"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// Failure classifies a backend error, telling Fallback whether trying
+// another backend makes sense.
+type Failure int
+
+const (
+	// FailRequest means the request can't succeed with any backend, e.g.
+	// because the audio file can't be read. The error is returned.
+	FailRequest Failure = iota
+	// FailTransient means the backend failed this time, e.g. with a server
+	// error that persisted through the retries. The next backend is tried.
+	FailTransient
+	// FailPermanent means the backend is unusable, e.g. because the API key
+	// is invalid or its quota is used up. It is skipped from now on.
+	FailPermanent
+)
+
+// Backend is a transcriber in a Fallback chain.
+type Backend struct {
+	Name        string
+	Transcriber domain.Transcriber
+	// Classify classifies the errors of Transcriber; nil treats all of
+	// them as transient.
+	Classify func(error) Failure
+	// Lookup marks a backend that only reuses earlier transcripts, like
+	// CacheOnly. It can't transcribe new audio, so it doesn't keep the
+	// chain available once the other backends are disabled.
+	Lookup bool
+}
+
+// Fallback is a Transcriber that tries its backends in order until one
+// succeeds. A backend that fails permanently is skipped for the rest of the
+// run; once all but the lookups are, requests that no lookup serves fail
+// with domain.ErrTranscriberUnavailable. It is safe for concurrent use if
+// the backends are.
+type Fallback struct {
+	backends []Backend
+	disabled []atomic.Bool
+	warn     io.Writer
+}
+
+// NewFallback chains backends. When one is disabled, a warning is written
+// to warn.
+func NewFallback(warn io.Writer, backends ...Backend) *Fallback {
+	return &Fallback{
+		backends: backends,
+		disabled: make([]atomic.Bool, len(backends)),
+		warn:     warn,
+	}
+}
+
+func (f *Fallback) Transcribe(ctx context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	var errs fallbackError
+	for i, b := range f.backends {
+		if f.disabled[i].Load() {
+			continue
+		}
+
+		t, err := b.Transcriber.Transcribe(ctx, req)
+		if err == nil {
+			return t, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+
+		failure := FailTransient
+		if b.Classify != nil {
+			failure = b.Classify(err)
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+		switch failure {
+		case FailRequest:
+			return nil, errs
+		case FailPermanent:
+			if f.disabled[i].CompareAndSwap(false, true) {
+				fmt.Fprintf(f.warn, "Warning: transcriber %s failed, not using it for the rest of the run: %v\n", b.Name, err)
+			}
+		}
+	}
+
+	if f.available() {
+		return nil, errs
+	}
+	return nil, fmt.Errorf("%w: %w", domain.ErrTranscriberUnavailable, errs)
+}
+
+// available reports whether a backend is left that can transcribe new
+// audio. A chain of lookups only stays available.
+func (f *Fallback) available() bool {
+	lookupsOnly := true
+	for i, b := range f.backends {
+		if b.Lookup {
+			continue
+		}
+		lookupsOnly = false
+		if !f.disabled[i].Load() {
+			return true
+		}
+	}
+	return lookupsOnly
+}
+
+// fallbackError holds the errors of the backends tried for a request.
+type fallbackError []error
+
+func (e fallbackError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e fallbackError) Unwrap() []error { return e }
+
+// ClassifyOpenAI classifies the errors of OpenAITranscriber, also wrapped in
+// Splitter and Cached. Authentication errors, an exhausted quota and unknown
+// models or endpoints are permanent; rate limits, server and network errors
+// (which have been retried already) and audio too large to upload are
+// transient. Other API errors concern the request, e.g. an unsupported file.
+func ClassifyOpenAI(err error) Failure {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		switch code := apiErr.StatusCode; {
+		case quotaExceeded(apiErr),
+			code == http.StatusUnauthorized,
+			code == http.StatusForbidden,
+			code == http.StatusNotFound:
+			return FailPermanent
+		case code == http.StatusRequestTimeout,
+			code == http.StatusTooManyRequests,
+			code >= 500:
+			return FailTransient
+		default:
+			return FailRequest
+		}
+	}
+
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrTooLarge) {
+		return FailTransient
+	}
+	return FailRequest
+}
+
+// quotaExceeded reports whether err says the account has no credit left,
+// which OpenAI signals with a 429 like a rate limit.
+func quotaExceeded(err *openai.Error) bool {
+	return err.StatusCode == http.StatusTooManyRequests && err.Code == "insufficient_quota"
+}
+
+// ClassifyLocal classifies the errors of LocalTranscriber. They are
+// transient: audio whisper.cpp or ffmpeg choke on may still work with
+// another backend.
+func ClassifyLocal(error) Failure {
+	return FailTransient
+}
+
+// ClassifyCacheOnly treats misses of CacheOnly as transient, so the next
+// backend transcribes the audio. CacheOnly backends are lookups (see
+// Backend.Lookup).
+func ClassifyCacheOnly(err error) Failure {
+	if errors.Is(err, ErrNotCached) {
+		return FailTransient
+	}
+	return FailRequest
+}
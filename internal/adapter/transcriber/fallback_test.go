@@ -0,0 +1,235 @@
+package transcriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+var testRequest = domain.TranscriptionRequest{
+	Media: fstest.MapFS{"PTT-20240115-WA0001.opus": &fstest.MapFile{Data: []byte("OggS")}},
+	Path:  "PTT-20240115-WA0001.opus",
+}
+
+// openAIError returns the error OpenAITranscriber reports for rep, without
+// retries.
+func openAIError(t *testing.T, rep reply) error {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(rep.status)
+		_, _ = w.Write([]byte(rep.body))
+	}))
+	defer srv.Close()
+
+	tr := NewOpenAITranscriber(OpenAIOptions{BaseURL: srv.URL})
+	_, err := tr.Transcribe(context.Background(), testRequest)
+	if err == nil {
+		t.Fatalf("Transcribe succeeded with status %d, want error", rep.status)
+	}
+	return err
+}
+
+func TestClassifyOpenAI(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+	apiError := func(status int) reply {
+		return reply{status: status, body: `{"error":{"message":"failed"}}`}
+	}
+
+	tests := []struct {
+		name  string
+		reply reply
+		want  Failure
+	}{
+		{"unauthorized", apiError(http.StatusUnauthorized), FailPermanent},
+		{"forbidden", apiError(http.StatusForbidden), FailPermanent},
+		{"unknown model", apiError(http.StatusNotFound), FailPermanent},
+		{"quota exceeded", reply{
+			status: http.StatusTooManyRequests,
+			body:   `{"error":{"message":"You exceeded your current quota.","type":"insufficient_quota","code":"insufficient_quota"}}`,
+		}, FailPermanent},
+		{"request timeout", apiError(http.StatusRequestTimeout), FailTransient},
+		{"rate limited", apiError(http.StatusTooManyRequests), FailTransient},
+		{"server error", apiError(http.StatusInternalServerError), FailTransient},
+		{"unavailable", apiError(http.StatusServiceUnavailable), FailTransient},
+		{"bad request", apiError(http.StatusBadRequest), FailRequest},
+		{"too large", apiError(http.StatusRequestEntityTooLarge), FailRequest},
+		{"unprocessable", apiError(http.StatusUnprocessableEntity), FailRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := openAIError(t, tt.reply)
+			if got := ClassifyOpenAI(err); got != tt.want {
+				t.Errorf("ClassifyOpenAI(%v) = %v, want %v", err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyOpenAINetwork(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "test")
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	tr := NewOpenAITranscriber(OpenAIOptions{BaseURL: srv.URL})
+	_, err := tr.Transcribe(context.Background(), testRequest)
+
+	tests := []struct {
+		name string
+		err  error
+		want Failure
+	}{
+		{"connection refused", err, FailTransient},
+		{"too large", fmt.Errorf("PTT-20240115-WA0001.opus: 30.0 MiB: %w", ErrTooLarge), FailTransient},
+		{"deadline", context.DeadlineExceeded, FailTransient},
+		{"unreadable file", errors.New("open PTT-20240115-WA0001.opus: file does not exist"), FailRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyOpenAI(tt.err); got != tt.want {
+				t.Errorf("ClassifyOpenAI(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClassifyCacheOnly(t *testing.T) {
+	if got := ClassifyCacheOnly(ErrNotCached); got != FailTransient {
+		t.Errorf("ClassifyCacheOnly(ErrNotCached) = %v, want FailTransient", got)
+	}
+	if got := ClassifyCacheOnly(errors.New("reading audio")); got != FailRequest {
+		t.Errorf("ClassifyCacheOnly(other) = %v, want FailRequest", got)
+	}
+}
+
+func always(f Failure) func(error) Failure {
+	return func(error) Failure { return f }
+}
+
+func TestFallbackOrder(t *testing.T) {
+	errBusy := errors.New("busy")
+
+	tests := []struct {
+		name      string
+		failures  []Failure // of the backends before the last one
+		wantCalls []int
+		wantErr   bool
+	}{
+		{"first succeeds", nil, []int{1}, false},
+		{"transient moves on", []Failure{FailTransient, FailTransient}, []int{1, 1, 1}, false},
+		{"permanent moves on", []Failure{FailPermanent}, []int{1, 1}, false},
+		{"request error stops", []Failure{FailTransient, FailRequest}, []int{1, 1, 0}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				backends []Backend
+				counters []*countingTranscriber
+			)
+			for i, f := range tt.failures {
+				c := &countingTranscriber{err: errBusy}
+				counters = append(counters, c)
+				backends = append(backends, Backend{Name: fmt.Sprint(i), Transcriber: c, Classify: always(f)})
+			}
+			last := &countingTranscriber{}
+			counters = append(counters, last)
+			backends = append(backends, Backend{Name: "last", Transcriber: last})
+
+			var warn strings.Builder
+			got, err := NewFallback(&warn, backends...).Transcribe(context.Background(), testRequest)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Transcribe error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Text != "Hallo" {
+				t.Errorf("Transcribe = %q, want the last backend's transcript", got.Text)
+			}
+			if err != nil && !errors.Is(err, errBusy) {
+				t.Errorf("Transcribe error = %v, want the backends' errors", err)
+			}
+			for i, c := range counters {
+				if c.calls != tt.wantCalls[i] {
+					t.Errorf("backend %d called %d times, want %d", i, c.calls, tt.wantCalls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFallbackDisablesBackend(t *testing.T) {
+	quota := errors.New("quota exceeded")
+	lookup := &countingTranscriber{err: ErrNotCached}
+	local := &countingTranscriber{err: errors.New("whisper.cpp crashed")}
+	api := &countingTranscriber{err: quota}
+
+	var warn strings.Builder
+	f := NewFallback(&warn,
+		Backend{Name: "cache", Transcriber: lookup, Classify: ClassifyCacheOnly, Lookup: true},
+		Backend{Name: "local", Transcriber: local, Classify: ClassifyLocal},
+		Backend{Name: "openai", Transcriber: api, Classify: always(FailPermanent)},
+	)
+
+	for range 3 {
+		_, err := f.Transcribe(context.Background(), testRequest)
+		if err == nil || errors.Is(err, domain.ErrTranscriberUnavailable) {
+			t.Fatalf("Transcribe error = %v, want a failure while local is left", err)
+		}
+	}
+	if api.calls != 1 {
+		t.Errorf("openai called %d times, want 1", api.calls)
+	}
+	if n := strings.Count(warn.String(), "Warning"); n != 1 {
+		t.Errorf("%d warnings, want 1:\n%s", n, warn.String())
+	}
+	if local.calls != 3 || lookup.calls != 3 {
+		t.Errorf("local called %d times, cache %d times, want 3 each", local.calls, lookup.calls)
+	}
+}
+
+func TestFallbackUnavailable(t *testing.T) {
+	lookup := &countingTranscriber{err: ErrNotCached}
+	api := &countingTranscriber{err: errors.New("quota exceeded")}
+
+	var warn strings.Builder
+	f := NewFallback(&warn,
+		Backend{Name: "cache", Transcriber: lookup, Classify: ClassifyCacheOnly, Lookup: true},
+		Backend{Name: "openai", Transcriber: api, Classify: always(FailPermanent)},
+	)
+
+	for i := range 2 {
+		_, err := f.Transcribe(context.Background(), testRequest)
+		if !errors.Is(err, domain.ErrTranscriberUnavailable) {
+			t.Fatalf("request %d: Transcribe error = %v, want ErrTranscriberUnavailable", i, err)
+		}
+	}
+	if api.calls != 1 {
+		t.Errorf("openai called %d times, want 1", api.calls)
+	}
+
+	// Cached transcripts are still served.
+	lookup.err = nil
+	if _, err := f.Transcribe(context.Background(), testRequest); err != nil {
+		t.Errorf("Transcribe with a cached transcript: %v", err)
+	}
+}
+
+func TestFallbackLookupsOnly(t *testing.T) {
+	lookup := &countingTranscriber{err: ErrNotCached}
+	f := NewFallback(&strings.Builder{},
+		Backend{Name: "cache", Transcriber: lookup, Classify: ClassifyCacheOnly, Lookup: true},
+	)
+
+	_, err := f.Transcribe(context.Background(), testRequest)
+	if !errors.Is(err, ErrNotCached) || errors.Is(err, domain.ErrTranscriberUnavailable) {
+		t.Errorf("Transcribe error = %v, want ErrNotCached only", err)
+	}
+}
@@ -0,0 +1,165 @@
+package transcriber
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// LocalTranscriber transcribes audio offline with whisper.cpp, so no audio
+// leaves the machine. Attachments are converted with ffmpeg to the 16 kHz
+// mono WAV that whisper.cpp expects.
+type LocalTranscriber struct {
+	binary string
+	model  string
+	ffmpeg string
+}
+
+// NewLocalTranscriber checks that the whisper.cpp CLI (e.g. "whisper-cli"),
+// the model file and ffmpeg are available.
+func NewLocalTranscriber(binary, model, ffmpeg string) (*LocalTranscriber, error) {
+	if model == "" {
+		return nil, errors.New("no whisper.cpp model configured")
+	}
+	if _, err := os.Stat(model); err != nil {
+		return nil, fmt.Errorf("whisper.cpp model: %w", err)
+	}
+
+	binPath, err := exec.LookPath(binary)
+	if err != nil {
+		return nil, fmt.Errorf("whisper.cpp binary: %w", err)
+	}
+	ffmpegPath, err := exec.LookPath(ffmpeg)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	return &LocalTranscriber{binary: binPath, model: model, ffmpeg: ffmpegPath}, nil
+}
+
+func (t *LocalTranscriber) Transcribe(ctx context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	dir, err := os.MkdirTemp("", "wachat-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	// ffmpeg needs a seekable input for M4A files, so the attachment is
+	// extracted first rather than piped.
+	input := filepath.Join(dir, "input"+path.Ext(req.Path))
+	if err := extract(req, input); err != nil {
+		return nil, err
+	}
+
+	wav := filepath.Join(dir, "audio.wav")
+	if _, _, err := run(ctx, t.ffmpeg, "-hide_banner", "-loglevel", "error", "-nostdin",
+		"-i", input, "-ar", "16000", "-ac", "1", "-c:a", "pcm_s16le", wav); err != nil {
+		return nil, fmt.Errorf("converting %s: %w", req.Path, err)
+	}
+
+	lang := req.Language
+	if lang == "" {
+		lang = "auto"
+	}
+	args := []string{"-m", t.model, "-f", wav, "-l", lang, "-np"}
+	if req.Prompt != "" {
+		args = append(args, "--prompt", req.Prompt)
+	}
+	out, _, err := run(ctx, t.binary, args...)
+	if err != nil {
+		return nil, fmt.Errorf("transcribing %s: %w", req.Path, err)
+	}
+
+	return parseWhisperOutput(out), nil
+}
+
+// whisperLineRe matches a segment line of whisper.cpp, e.g.
+// "[00:00:00.000 --> 00:00:04.520]   Hello there.".
+var whisperLineRe = regexp.MustCompile(`^\[(\d+):(\d{2}):(\d{2}\.\d+) --> (\d+):(\d{2}):(\d{2}\.\d+)\]\s*(.*)$`)
+
+// parseWhisperOutput reads the segments whisper.cpp prints, one per line.
+// Lines without timestamps only add to the text.
+func parseWhisperOutput(out string) *domain.Transcript {
+	transcript := &domain.Transcript{}
+	var words []string
+	for line := range strings.Lines(out) {
+		line = strings.TrimSpace(line)
+		m := whisperLineRe.FindStringSubmatch(line)
+		if m == nil {
+			words = append(words, strings.Fields(line)...)
+			continue
+		}
+		text := strings.Join(strings.Fields(m[7]), " ")
+		transcript.Segments = append(transcript.Segments, domain.Segment{
+			Start: whisperTime(m[1], m[2], m[3]),
+			End:   whisperTime(m[4], m[5], m[6]),
+			Text:  text,
+		})
+		words = append(words, strings.Fields(text)...)
+	}
+	transcript.Text = strings.Join(words, " ")
+	return transcript
+}
+
+func whisperTime(h, m, s string) time.Duration {
+	hours, _ := strconv.Atoi(h)
+	minutes, _ := strconv.Atoi(m)
+	secs, _ := strconv.ParseFloat(s, 64)
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute + seconds(secs)
+}
+
+// Variant describes the settings that affect the transcripts (see Cached).
+func (t *LocalTranscriber) Variant() string {
+	return LocalVariant(t.model)
+}
+
+// LocalVariant is the Variant of a LocalTranscriber using model.
+func LocalVariant(model string) string {
+	return "whisper.cpp/" + filepath.Base(model)
+}
+
+func extract(req domain.TranscriptionRequest, dst string) error {
+	src, err := req.Media.Open(req.Path)
+	if err != nil {
+		return fmt.Errorf("opening audio file %s: %w", req.Path, err)
+	}
+	defer src.Close()
+
+	f, err := os.Create(dst) //nolint:gosec // dst is within our temp dir
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("reading audio file %s: %w", req.Path, err)
+	}
+	return f.Close()
+}
+
+// run executes a command and returns its standard output and error. The
+// returned error includes what the command wrote to standard error.
+func run(ctx context.Context, name string, args ...string) (stdout, stderr string, err error) {
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.CommandContext(ctx, name, args...) //nolint:gosec // binaries are configured by the user
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(errBuf.String()); msg != "" {
+			return "", "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", "", err
+	}
+	return outBuf.String(), errBuf.String(), nil
+}
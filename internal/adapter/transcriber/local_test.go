@@ -0,0 +1,39 @@
+package transcriber
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+func TestParseWhisperOutput(t *testing.T) {
+	out := `
+[00:00:00.000 --> 00:00:04.520]   Hallo Ben,  kurz zu morgen.
+[00:00:04.520 --> 00:01:02.250]   Wir treffen uns um acht.
+(Musik)
+[01:02:03.500 --> 01:02:05.000]   Bis dann.
+`
+	got := parseWhisperOutput(out)
+
+	wantText := "Hallo Ben, kurz zu morgen. Wir treffen uns um acht. (Musik) Bis dann."
+	if got.Text != wantText {
+		t.Errorf("Text = %q, want %q", got.Text, wantText)
+	}
+	wantSegments := []domain.Segment{
+		{Start: 0, End: 4520 * time.Millisecond, Text: "Hallo Ben, kurz zu morgen."},
+		{Start: 4520 * time.Millisecond, End: time.Minute + 2250*time.Millisecond, Text: "Wir treffen uns um acht."},
+		{Start: time.Hour + 2*time.Minute + 3500*time.Millisecond, End: time.Hour + 2*time.Minute + 5*time.Second, Text: "Bis dann."},
+	}
+	if !slices.Equal(got.Segments, wantSegments) {
+		t.Errorf("Segments = %+v, want %+v", got.Segments, wantSegments)
+	}
+}
+
+func TestParseWhisperOutputWithoutTimestamps(t *testing.T) {
+	got := parseWhisperOutput(" Hallo Ben.\n Bis dann.\n")
+	if got.Text != "Hallo Ben. Bis dann." || len(got.Segments) != 0 {
+		t.Errorf("parseWhisperOutput = %+v, want the text without segments", got)
+	}
+}
@@ -3,51 +3,193 @@ package transcriber
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
+	"io"
+	"mime"
+	"path"
 	"strings"
+	"time"
 
 	"github.com/openai/openai-go/v3"
+	"github.com/openai/openai-go/v3/option"
+
+	"github.com/joern1811/wachat/internal/domain"
 )
 
-// OpenAITranscriber transcribes audio files using the OpenAI Whisper API.
-// The API key is read from the OPENAI_API_KEY environment variable by the SDK.
+// OpenAITranscriber transcribes audio files using the OpenAI transcription
+// API or a compatible server. The API key is read from the OPENAI_API_KEY
+// environment variable by the SDK. It is safe for concurrent use.
 type OpenAITranscriber struct {
 	client openai.Client
+	opts   OpenAIOptions
+}
+
+// OpenAIOptions configures an OpenAITranscriber.
+type OpenAIOptions struct {
+	// BaseURL of an OpenAI-compatible API, e.g. a self-hosted
+	// faster-whisper server. Empty means OPENAI_BASE_URL or the OpenAI API.
+	BaseURL string
+	// Model defaults to whisper-1.
+	Model string
+	// Temperature is the sampling temperature; nil uses the API default.
+	Temperature *float64
+	// Timeout limits each request attempt; zero means no limit.
+	Timeout time.Duration
+	// Segments requests the transcript's segments with timestamps, as
+	// verbose_json. Only whisper-1 and the Whisper models of compatible
+	// servers support it, so it is ignored for the GPT-based models.
+	Segments bool
+
+	Retry RetryPolicy
+	// Limiter paces the requests; nil means no limit.
+	Limiter *RateLimiter
 }
 
-func NewOpenAITranscriber() *OpenAITranscriber {
+func NewOpenAITranscriber(opts OpenAIOptions) *OpenAITranscriber {
+	if opts.Model == "" {
+		opts.Model = openai.AudioModelWhisper1
+	}
+
+	// Retries are handled by opts.Retry, which honours Retry-After. The
+	// delay is also passed to opts.Limiter, so the other workers hold off.
+	clientOpts := []option.RequestOption{option.WithMaxRetries(0)}
+	if opts.BaseURL != "" {
+		clientOpts = append(clientOpts, option.WithBaseURL(opts.BaseURL))
+	}
+	if opts.Timeout > 0 {
+		clientOpts = append(clientOpts, option.WithRequestTimeout(opts.Timeout))
+	}
+
 	return &OpenAITranscriber{
-		client: openai.NewClient(),
+		client: openai.NewClient(clientOpts...),
+		opts:   opts,
 	}
 }
 
-func (t *OpenAITranscriber) Transcribe(ctx context.Context, audioPath string) (string, error) {
-	// Whisper doesn't accept .opus directly, but WhatsApp .opus files are
-	// actually OGG/Opus containers. Symlink with .ogg extension so the API
-	// accepts the file.
-	actualPath := audioPath
-	if strings.ToLower(filepath.Ext(audioPath)) == ".opus" {
-		oggPath := strings.TrimSuffix(audioPath, filepath.Ext(audioPath)) + ".ogg"
-		if err := os.Symlink(audioPath, oggPath); err == nil {
-			actualPath = oggPath
-			defer os.Remove(oggPath)
+func (t *OpenAITranscriber) Transcribe(ctx context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	name, contentType := uploadName(req.Path)
+
+	var transcript *domain.Transcript
+	err := t.opts.Retry.do(ctx, func() error {
+		if err := t.opts.Limiter.Wait(ctx); err != nil {
+			return err
 		}
-	}
 
-	f, err := os.Open(actualPath)
-	if err != nil {
-		return "", fmt.Errorf("opening audio file %s: %w", actualPath, err)
-	}
-	defer f.Close()
+		// The attachment is streamed straight from the export (e.g. the
+		// zip) into the request body, so nothing is written to disk. It
+		// is reopened for every attempt.
+		f, err := req.Media.Open(req.Path)
+		if err != nil {
+			return fmt.Errorf("opening audio file: %w", err)
+		}
+		defer f.Close()
 
-	transcription, err := t.client.Audio.Transcriptions.New(ctx, openai.AudioTranscriptionNewParams{
-		Model: openai.AudioModelWhisper1,
-		File:  f,
+		transcription, err := t.client.Audio.Transcriptions.New(ctx, t.params(req, openai.File(f, name, contentType)))
+		if err != nil {
+			if delay, ok := retryAfter(err); ok {
+				t.opts.Limiter.Pause(delay)
+			}
+			return err
+		}
+		transcript = t.transcript(transcription)
+		return nil
 	})
 	if err != nil {
-		return "", fmt.Errorf("transcribing %s: %w", audioPath, err)
+		return nil, fmt.Errorf("transcribing %s: %w", req.Path, err)
+	}
+
+	return transcript, nil
+}
+
+// segmented reports whether segments with timestamps are requested. The
+// GPT-based models only return the text.
+func (t *OpenAITranscriber) segmented() bool {
+	return t.opts.Segments && !strings.HasPrefix(t.opts.Model, "gpt-")
+}
+
+func (t *OpenAITranscriber) transcript(res *openai.AudioTranscriptionNewResponseUnion) *domain.Transcript {
+	if !t.segmented() {
+		return &domain.Transcript{Text: res.Text}
+	}
+
+	verbose := res.AsTranscriptionVerbose()
+	transcript := &domain.Transcript{Text: verbose.Text}
+	for _, seg := range verbose.Segments {
+		transcript.Segments = append(transcript.Segments, domain.Segment{
+			Start: seconds(seg.Start),
+			End:   seconds(seg.End),
+			Text:  strings.TrimSpace(seg.Text),
+		})
+	}
+	return transcript
+}
+
+func (t *OpenAITranscriber) params(req domain.TranscriptionRequest, file io.Reader) openai.AudioTranscriptionNewParams {
+	params := openai.AudioTranscriptionNewParams{
+		Model: t.opts.Model,
+		File:  file,
+	}
+	if req.Language != "" {
+		params.Language = openai.String(req.Language)
+	}
+	if req.Prompt != "" {
+		params.Prompt = openai.String(req.Prompt)
+	}
+	if t.opts.Temperature != nil {
+		params.Temperature = openai.Float(*t.opts.Temperature)
+	}
+	if t.segmented() {
+		params.ResponseFormat = openai.AudioResponseFormatVerboseJSON
+		params.TimestampGranularities = []string{"segment"}
+	}
+	return params
+}
+
+// Model returns the transcription model in use.
+func (t *OpenAITranscriber) Model() string {
+	return t.opts.Model
+}
+
+// Variant describes the settings that affect the transcripts (see Cached).
+func (t *OpenAITranscriber) Variant() string {
+	v := "openai/" + t.opts.Model
+	if t.opts.BaseURL != "" {
+		v += " url=" + t.opts.BaseURL
+	}
+	if t.opts.Temperature != nil {
+		v += fmt.Sprintf(" temperature=%g", *t.opts.Temperature)
 	}
+	// Transcripts made without segments can't serve runs that want them.
+	if t.segmented() {
+		v += " segments"
+	}
+	return v
+}
+
+// uploadName returns the file name and content type to upload an attachment
+// with. Whisper doesn't accept .opus directly, but WhatsApp .opus files are
+// actually OGG/Opus containers, so they are sent with an .ogg extension.
+func uploadName(mediaPath string) (name, contentType string) {
+	name = path.Base(mediaPath)
+	ext := strings.ToLower(path.Ext(name))
+	if ext == ".opus" {
+		name = strings.TrimSuffix(name, path.Ext(name)) + ".ogg"
+		ext = ".ogg"
+	}
+
+	if ct, ok := audioContentTypes[ext]; ok {
+		return name, ct
+	}
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return name, ct
+	}
+	return name, "application/octet-stream"
+}
 
-	return transcription.Text, nil
+// audioContentTypes covers audio formats missing from Go's builtin MIME table.
+var audioContentTypes = map[string]string{
+	".ogg": "audio/ogg",
+	".m4a": "audio/mp4",
+	".mp3": "audio/mpeg",
+	".aac": "audio/aac",
+	".wav": "audio/wav",
 }
@@ -0,0 +1,238 @@
+package transcriber
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// reply is a canned response of the test server.
+type reply struct {
+	status int
+	header map[string]string
+	body   string
+	delay  time.Duration // before the response is sent
+}
+
+const transcriptBody = `{"text":"Hallo","language":"german","duration":1.5,"segments":[{"id":0,"start":0,"end":1.5,"text":" Hallo"}]}`
+
+func TestOpenAIRetries(t *testing.T) {
+	quota := reply{
+		status: http.StatusTooManyRequests,
+		body:   `{"error":{"message":"You exceeded your current quota.","type":"insufficient_quota","code":"insufficient_quota"}}`,
+	}
+
+	tests := []struct {
+		name     string
+		replies  []reply
+		timeout  time.Duration // per attempt
+		wantErr  bool
+		wantMin  time.Duration // minimum duration of the call
+		attempts int
+	}{
+		{
+			name: "rate limited",
+			replies: []reply{
+				{status: http.StatusTooManyRequests, header: map[string]string{"Retry-After-Ms": "200"}, body: `{"error":{"message":"slow down"}}`},
+				{status: http.StatusOK, body: transcriptBody},
+			},
+			wantMin:  200 * time.Millisecond,
+			attempts: 2,
+		},
+		{
+			name: "server errors",
+			replies: []reply{
+				{status: http.StatusBadGateway, body: `{"error":{"message":"bad gateway"}}`},
+				{status: http.StatusServiceUnavailable, body: `{"error":{"message":"unavailable"}}`},
+				{status: http.StatusOK, body: transcriptBody},
+			},
+			attempts: 3,
+		},
+		{
+			name: "server errors exhaust retries",
+			replies: []reply{
+				{status: http.StatusInternalServerError, body: `{"error":{"message":"boom"}}`},
+			},
+			wantErr:  true,
+			attempts: 4,
+		},
+		{
+			name:    "attempt timed out",
+			timeout: 50 * time.Millisecond,
+			replies: []reply{
+				{status: http.StatusOK, body: transcriptBody, delay: 300 * time.Millisecond},
+				{status: http.StatusOK, body: transcriptBody},
+			},
+			attempts: 2,
+		},
+		{
+			name:     "quota exceeded",
+			replies:  []reply{quota},
+			wantErr:  true,
+			attempts: 1,
+		},
+		{
+			name:     "bad request",
+			replies:  []reply{{status: http.StatusBadRequest, body: `{"error":{"message":"invalid file format"}}`}},
+			wantErr:  true,
+			attempts: 1,
+		},
+	}
+
+	t.Setenv("OPENAI_API_KEY", "test")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1))
+				rep := tt.replies[min(n, len(tt.replies))-1]
+				select {
+				case <-time.After(rep.delay):
+				case <-r.Context().Done():
+					return
+				}
+				for k, v := range rep.header {
+					w.Header().Set(k, v)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(rep.status)
+				_, _ = w.Write([]byte(rep.body))
+			}))
+			defer srv.Close()
+
+			tr := NewOpenAITranscriber(OpenAIOptions{
+				BaseURL:  srv.URL,
+				Timeout:  tt.timeout,
+				Segments: true,
+				Retry:    RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond},
+			})
+
+			start := time.Now()
+			got, err := tr.Transcribe(context.Background(), domain.TranscriptionRequest{
+				Media: fstest.MapFS{"PTT-20240115-WA0001.opus": &fstest.MapFile{Data: []byte("OggS")}},
+				Path:  "PTT-20240115-WA0001.opus",
+			})
+			elapsed := time.Since(start)
+
+			if n := int(attempts.Load()); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+			if elapsed < tt.wantMin {
+				t.Errorf("returned after %s, want at least %s", elapsed, tt.wantMin)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Transcribe = %q, want error", got.Text)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Transcribe: %v", err)
+			}
+			if got.Text != "Hallo" || len(got.Segments) != 1 || got.Segments[0].End != 1500*time.Millisecond {
+				t.Errorf("Transcribe = %+v, want \"Hallo\" with one segment", got)
+			}
+		})
+	}
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	l := NewRateLimiter(6000) // one request per 10ms
+	l.Pause(100 * time.Millisecond)
+
+	start := time.Now()
+	if err := l.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Errorf("Wait returned after %s, want about 100ms", elapsed)
+	}
+}
+
+func TestOpenAIStopsWhenCallerGivesUp(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		select {
+		case <-time.After(300 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	t.Setenv("OPENAI_API_KEY", "test")
+	tr := NewOpenAITranscriber(OpenAIOptions{
+		BaseURL: srv.URL,
+		Retry:   RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := tr.Transcribe(ctx, domain.TranscriptionRequest{
+		Media: fstest.MapFS{"PTT-20240115-WA0001.opus": &fstest.MapFile{Data: []byte("OggS")}},
+		Path:  "PTT-20240115-WA0001.opus",
+	})
+	if err == nil {
+		t.Fatal("Transcribe succeeded, want error")
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+}
+
+func TestOpenAISegments(t *testing.T) {
+	tests := []struct {
+		name         string
+		model        string
+		segments     bool
+		body         string
+		wantFormat   string
+		wantSegments int
+	}{
+		{"not wanted", "whisper-1", false, `{"text":"Hallo"}`, "", 0},
+		{"wanted", "whisper-1", true, transcriptBody, "verbose_json", 1},
+		{"custom model", "large-v3", true, transcriptBody, "verbose_json", 1},
+		{"gpt model", "gpt-4o-transcribe", true, `{"text":"Hallo"}`, "", 0},
+	}
+
+	t.Setenv("OPENAI_API_KEY", "test")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var format, granularities string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				format = r.FormValue("response_format")
+				granularities = r.FormValue("timestamp_granularities[]")
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			tr := NewOpenAITranscriber(OpenAIOptions{BaseURL: srv.URL, Model: tt.model, Segments: tt.segments})
+			got, err := tr.Transcribe(context.Background(), domain.TranscriptionRequest{
+				Media: fstest.MapFS{"PTT-20240115-WA0001.opus": &fstest.MapFile{Data: []byte("OggS")}},
+				Path:  "PTT-20240115-WA0001.opus",
+			})
+			if err != nil {
+				t.Fatalf("Transcribe: %v", err)
+			}
+
+			if format != tt.wantFormat {
+				t.Errorf("response_format = %q, want %q", format, tt.wantFormat)
+			}
+			if segmented := tt.wantFormat != ""; segmented != (granularities == "segment") {
+				t.Errorf("timestamp_granularities = %q with response_format %q", granularities, format)
+			}
+			if got.Text != "Hallo" || len(got.Segments) != tt.wantSegments {
+				t.Errorf("Transcribe = %+v, want \"Hallo\" with %d segment(s)", got, tt.wantSegments)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package transcriber
+
+import (
+	"time"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// ModelPrice is the list price of an OpenAI transcription model.
+type ModelPrice struct {
+	Model string
+	// PerMinute is the price in USD per minute of audio.
+	PerMinute float64
+}
+
+// Prices lists the known transcription models. Self-hosted servers and
+// other models have no known price.
+var Prices = []ModelPrice{
+	{Model: openai.AudioModelWhisper1, PerMinute: 0.006},
+	{Model: openai.AudioModelGPT4oTranscribe, PerMinute: 0.006},
+	{Model: openai.AudioModelGPT4oMiniTranscribe, PerMinute: 0.003},
+}
+
+// PriceOf returns the price of model, if known.
+func PriceOf(model string) (ModelPrice, bool) {
+	for _, p := range Prices {
+		if p.Model == model {
+			return p, true
+		}
+	}
+	return ModelPrice{}, false
+}
+
+// Cost estimates the price in USD of transcribing audio of duration d.
+func (p ModelPrice) Cost(d time.Duration) float64 {
+	return d.Minutes() * p.PerMinute
+}
@@ -0,0 +1,65 @@
+package transcriber
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter spaces requests evenly to stay below a number of requests per
+// minute. It is safe for concurrent use, so one limiter paces all workers.
+type RateLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// NewRateLimiter returns a limiter for perMinute requests per minute, or nil
+// (no limit) if perMinute is not positive.
+func NewRateLimiter(perMinute int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &RateLimiter{interval: time.Minute / time.Duration(perMinute)}
+}
+
+// Wait blocks until the next request may be sent. A nil limiter never
+// blocks.
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(slot))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Pause holds off all requests for d, e.g. as asked by a Retry-After
+// header. A nil limiter ignores it.
+func (l *RateLimiter) Pause(d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); l.next.Before(until) {
+		l.next = until
+	}
+}
@@ -0,0 +1,120 @@
+package transcriber
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/openai/openai-go/v3"
+)
+
+// RetryPolicy controls how often and how long failed API requests are
+// retried. Only rate limits (429), server errors (5xx), timeouts and network
+// errors are retried.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry; it doubles with each
+	// further retry, up to MaxDelay. Zero means one second.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between retries. Zero means one minute.
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used when no policy is configured.
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: time.Minute}
+
+// do calls fn until it succeeds, returns an error that isn't worth retrying
+// or the retries are used up. It waits between attempts as the server asks
+// via Retry-After, or with jittered exponential backoff otherwise.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		// A timed out attempt (Timeout) is retried; the caller's context
+		// ending is not.
+		if err == nil || ctx.Err() != nil || attempt >= p.MaxRetries || !retryable(err) {
+			return err
+		}
+
+		delay, ok := retryAfter(err)
+		if !ok {
+			delay = p.backoff(attempt)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay before retry number attempt+1: the exponential
+// delay with "equal jitter", i.e. a random value between half and all of it,
+// so parallel workers don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	base, maxDelay := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = time.Second
+	}
+	if maxDelay <= 0 {
+		maxDelay = time.Minute
+	}
+
+	d := maxDelay
+	if attempt < 30 {
+		d = min(base<<attempt, maxDelay)
+	}
+	return d/2 + rand.N(d/2+1) //nolint:gosec // jitter needs no secure random source
+}
+
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		if quotaExceeded(apiErr) {
+			return false
+		}
+		code := apiErr.StatusCode
+		return code == http.StatusRequestTimeout || code == http.StatusTooManyRequests || code >= 500
+	}
+
+	// Errors of the HTTP client itself (connection refused, reset, ...).
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryAfter reads the delay requested by the server, in the headers
+// OpenAI uses: Retry-After-Ms, or Retry-After in seconds or as a date.
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *openai.Error
+	if !errors.As(err, &apiErr) || apiErr.Response == nil {
+		return 0, false
+	}
+	h := apiErr.Response.Header
+
+	if ms, err := strconv.ParseFloat(h.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+
+	v := h.Get("Retry-After")
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
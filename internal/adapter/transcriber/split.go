@@ -0,0 +1,282 @@
+package transcriber
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+const (
+	// maxUploadBytes stays just below the 25 MB upload limit of the API.
+	maxUploadBytes = 24 << 20
+	// maxChunkDuration stays below the duration limit of the newer models
+	// (1500 seconds for gpt-4o-transcribe).
+	maxChunkDuration = 20 * time.Minute
+	// probeMinBytes is the size below which audio is assumed to be within
+	// both limits, so short voice messages aren't probed. Even at a high
+	// voice bitrate, 1 MB is only a few minutes.
+	probeMinBytes = 1 << 20
+	// chunkOverlap is repeated at the start of each chunk, so no word is
+	// lost at a cut. The duplicated words are removed when stitching.
+	chunkOverlap = 2 * time.Second
+	// silenceWindow is the final part of a chunk searched for a silence to
+	// cut at.
+	silenceWindow = 3 * time.Minute
+)
+
+// ErrTooLarge is returned for audio above the upload limit that can't be
+// split because ffmpeg is missing.
+var ErrTooLarge = errors.New("above the upload limit")
+
+// Splitter is a Transcriber that makes oversized audio fit the limits of the
+// API: long audio is split into overlapping chunks, cut at silences where
+// possible, and large files are re-encoded as compact mono Opus. The chunks
+// are transcribed with Next and the texts stitched together, so callers see
+// a single transcript.
+type Splitter struct {
+	next            domain.Transcriber
+	ffmpeg, ffprobe string
+}
+
+// NewSplitter wraps next. Without ffmpeg and ffprobe, audio can't be split;
+// files above the upload limit are then rejected before uploading.
+func NewSplitter(next domain.Transcriber, ffmpeg, ffprobe string) *Splitter {
+	s := &Splitter{next: next}
+	if p, err := exec.LookPath(ffmpeg); err == nil {
+		s.ffmpeg = p
+	}
+	if p, err := exec.LookPath(ffprobe); err == nil {
+		s.ffprobe = p
+	}
+	return s
+}
+
+func (s *Splitter) Transcribe(ctx context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	info, err := fs.Stat(req.Media, req.Path)
+	if err != nil || info.Size() <= probeMinBytes {
+		return s.next.Transcribe(ctx, req)
+	}
+	if s.ffmpeg == "" || s.ffprobe == "" {
+		if info.Size() > maxUploadBytes {
+			return nil, fmt.Errorf("%s is %.1f MB, %w; install ffmpeg to split it",
+				req.Path, float64(info.Size())/(1<<20), ErrTooLarge)
+		}
+		return s.next.Transcribe(ctx, req)
+	}
+
+	dir, err := os.MkdirTemp("", "wachat-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input := filepath.Join(dir, "input"+path.Ext(req.Path))
+	if err := extract(req, input); err != nil {
+		return nil, err
+	}
+
+	duration, err := s.duration(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("probing %s: %w", req.Path, err)
+	}
+	if info.Size() <= maxUploadBytes && duration <= maxChunkDuration {
+		return s.next.Transcribe(ctx, req)
+	}
+
+	var silences []time.Duration
+	if duration > maxChunkDuration {
+		if silences, err = s.silences(ctx, input); err != nil {
+			return nil, fmt.Errorf("detecting silences in %s: %w", req.Path, err)
+		}
+	}
+	cuts := chunkCuts(duration, maxChunkDuration, silences)
+
+	transcript := &domain.Transcript{}
+	start := time.Duration(0)
+	for i, end := range cuts {
+		chunk := fmt.Sprintf("chunk-%02d.ogg", i)
+		if err := s.encode(ctx, input, filepath.Join(dir, chunk), start, end); err != nil {
+			return nil, fmt.Errorf("splitting %s: %w", req.Path, err)
+		}
+
+		part, err := s.next.Transcribe(ctx, domain.TranscriptionRequest{
+			Media:    os.DirFS(dir),
+			Path:     chunk,
+			Language: req.Language,
+			Prompt:   chunkPrompt(req.Prompt, transcript.Text),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s, part %d of %d: %w", req.Path, i+1, len(cuts), err)
+		}
+		repeats := repeatedWords(transcript.Text, part.Text)
+		transcript.Segments = stitchSegments(transcript.Segments, part.Segments, start, repeats)
+		transcript.Text = stitch(transcript.Text, part.Text)
+		start = max(end-chunkOverlap, 0)
+	}
+	return transcript, nil
+}
+
+func (s *Splitter) duration(ctx context.Context, file string) (time.Duration, error) {
+	out, _, err := run(ctx, s.ffprobe, "-v", "error", "-show_entries", "format=duration", "-of", "csv=p=0", file)
+	if err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseFloat(strings.TrimSpace(out), 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected duration %q", strings.TrimSpace(out))
+	}
+	return seconds(secs), nil
+}
+
+var silenceRe = regexp.MustCompile(`silence_(start|end): (-?[\d.]+)`)
+
+// silences returns the midpoints of the silent passages in file.
+func (s *Splitter) silences(ctx context.Context, file string) ([]time.Duration, error) {
+	_, log, err := run(ctx, s.ffmpeg, "-hide_banner", "-nostdin", "-i", file,
+		"-af", "silencedetect=noise=-35dB:d=0.4", "-f", "null", "-")
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mids  []time.Duration
+		start time.Duration
+	)
+	for _, m := range silenceRe.FindAllStringSubmatch(log, -1) {
+		secs, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			continue
+		}
+		if m[1] == "start" {
+			start = seconds(max(secs, 0))
+		} else {
+			mids = append(mids, (start+seconds(secs))/2)
+		}
+	}
+	return mids, nil
+}
+
+// encode writes the part of input between start and end as mono 16 kHz
+// Opus at 24 kbit/s, which is plenty for speech and keeps a 20-minute chunk
+// around 4 MB.
+func (s *Splitter) encode(ctx context.Context, input, output string, start, end time.Duration) error {
+	_, _, err := run(ctx, s.ffmpeg, "-hide_banner", "-loglevel", "error", "-nostdin",
+		"-ss", formatSeconds(start), "-i", input, "-t", formatSeconds(end-start),
+		"-ac", "1", "-ar", "16000", "-c:a", "libopus", "-b:a", "24k", output)
+	return err
+}
+
+// chunkCuts returns the end of each chunk. A chunk ends at the last silence
+// in its final silenceWindow, or after maxLen if there is none.
+func chunkCuts(duration, maxLen time.Duration, silences []time.Duration) []time.Duration {
+	var cuts []time.Duration
+	start := time.Duration(0)
+	for duration-start > maxLen {
+		end := start + maxLen
+		cut := end
+		for _, s := range silences {
+			if s > end-silenceWindow && s > start+chunkOverlap && s <= end {
+				cut = s
+			}
+		}
+		cuts = append(cuts, cut)
+		start = cut - chunkOverlap
+	}
+	return append(cuts, duration)
+}
+
+// chunkPrompt continues the prompt with the end of the transcript so far,
+// which helps the model keep style and spelling across chunks.
+func chunkPrompt(prompt, text string) string {
+	const tail = 200
+	if len(text) > tail {
+		text = text[len(text)-tail:]
+		if i := strings.IndexByte(text, ' '); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	return strings.TrimSpace(prompt + " " + text)
+}
+
+// maxOverlapWords bounds how many words two chunks can have in common: a
+// few seconds of overlap hold far fewer.
+const maxOverlapWords = 20
+
+// stitch appends the transcript of the next chunk, dropping its leading
+// words that repeat the end of text due to the overlap.
+func stitch(text, next string) string {
+	if text == "" {
+		return next
+	}
+	a, b := strings.Fields(text), strings.Fields(next)
+	return strings.Join(append(a, b[repeatedWords(text, next):]...), " ")
+}
+
+// repeatedWords counts the leading words of next that repeat the end of
+// text.
+func repeatedWords(text, next string) int {
+	a, b := strings.Fields(text), strings.Fields(next)
+	for n := min(len(a), len(b), maxOverlapWords); n > 0; n-- {
+		if sameWords(a[len(a)-n:], b[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// stitchSegments appends the segments of the chunk starting at offset,
+// shifted to their position in the whole audio. The first repeats words are
+// dropped from them, as stitch drops them from the text, and segments left
+// without words are left out.
+func stitchSegments(segs, next []domain.Segment, offset time.Duration, repeats int) []domain.Segment {
+	for _, seg := range next {
+		if repeats > 0 {
+			words := strings.Fields(seg.Text)
+			if repeats >= len(words) {
+				repeats -= len(words)
+				continue
+			}
+			seg.Text = strings.Join(words[repeats:], " ")
+			repeats = 0
+		}
+		seg.Start += offset
+		seg.End += offset
+		segs = append(segs, seg)
+	}
+	return segs
+}
+
+func sameWords(a, b []string) bool {
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}))
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
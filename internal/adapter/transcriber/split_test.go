@@ -0,0 +1,121 @@
+package transcriber
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+func TestChunkCuts(t *testing.T) {
+	const maxLen = 20 * time.Minute
+	minutes := func(m float64) time.Duration { return time.Duration(m * float64(time.Minute)) }
+
+	tests := []struct {
+		name     string
+		duration time.Duration
+		silences []time.Duration
+		want     []time.Duration
+	}{
+		{"short", minutes(5), nil, []time.Duration{minutes(5)}},
+		{"exactly max", maxLen, nil, []time.Duration{maxLen}},
+		{
+			name:     "no silences",
+			duration: minutes(45),
+			want:     []time.Duration{minutes(20), minutes(40) - chunkOverlap, minutes(45)},
+		},
+		{
+			name:     "last silence in window",
+			duration: minutes(30),
+			silences: []time.Duration{minutes(10), minutes(18), minutes(19)},
+			want:     []time.Duration{minutes(19), minutes(30)},
+		},
+		{
+			name:     "silence before window",
+			duration: minutes(30),
+			silences: []time.Duration{minutes(10), minutes(16)},
+			want:     []time.Duration{minutes(20), minutes(30)},
+		},
+		{
+			name:     "silence after max",
+			duration: minutes(30),
+			silences: []time.Duration{minutes(21)},
+			want:     []time.Duration{minutes(20), minutes(30)},
+		},
+		{
+			name:     "second chunk from silence",
+			duration: minutes(50),
+			silences: []time.Duration{minutes(19), minutes(38)},
+			want:     []time.Duration{minutes(19), minutes(38), minutes(50)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := chunkCuts(tt.duration, maxLen, tt.silences)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("chunkCuts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStitch(t *testing.T) {
+	tests := []struct {
+		name, text, next, want string
+	}{
+		{"first chunk", "", "Hallo Anna", "Hallo Anna"},
+		{"no overlap", "Wir treffen uns", "morgen um acht", "Wir treffen uns morgen um acht"},
+		{"overlap", "Wir treffen uns morgen", "uns morgen um acht", "Wir treffen uns morgen um acht"},
+		{"case and punctuation", "Wir treffen uns, Morgen.", "morgen um acht", "Wir treffen uns, Morgen. um acht"},
+		{"longest overlap", "ja ja ja", "ja ja nein", "ja ja ja nein"},
+		{"whole next chunk", "bis dann", "dann", "bis dann"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stitch(tt.text, tt.next); got != tt.want {
+				t.Errorf("stitch(%q, %q) = %q, want %q", tt.text, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStitchSegments(t *testing.T) {
+	sec := func(s float64) time.Duration { return time.Duration(s * float64(time.Second)) }
+	first := []domain.Segment{
+		{Start: 0, End: sec(4), Text: "Hallo Ben, kurz zu morgen."},
+		{Start: sec(4), End: sec(1198), Text: "Wir treffen uns"},
+	}
+	second := []domain.Segment{
+		{Start: 0, End: sec(1), Text: "treffen"},
+		{Start: sec(1), End: sec(3), Text: "uns um acht."},
+		{Start: sec(3), End: sec(6), Text: "Bis dann."},
+	}
+	offset := 20*time.Minute - chunkOverlap
+	text := "Hallo Ben, kurz zu morgen. Wir treffen uns"
+	next := "treffen uns um acht. Bis dann."
+
+	segs := stitchSegments(nil, first, 0, 0)
+	segs = stitchSegments(segs, second, offset, repeatedWords(text, next))
+
+	want := []domain.Segment{
+		first[0],
+		first[1],
+		{Start: offset + sec(1), End: offset + sec(3), Text: "um acht."},
+		{Start: offset + sec(3), End: offset + sec(6), Text: "Bis dann."},
+	}
+	if !slices.Equal(segs, want) {
+		t.Errorf("stitchSegments = %+v, want %+v", segs, want)
+	}
+
+	var words []string
+	for _, seg := range segs {
+		words = append(words, seg.Text)
+	}
+	if got, want := strings.Join(words, " "), stitch(text, next); got != want {
+		t.Errorf("segments read %q, stitched text %q", got, want)
+	}
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrBudgetExceeded is returned when a run would exceed, or has used up,
+// its Budget.
+var ErrBudgetExceeded = errors.New("transcription budget exceeded")
+
+// Budget caps the audio sent for transcription in a run.
+type Budget struct {
+	// MaxDuration caps the total duration of the voice messages; zero
+	// means no cap.
+	MaxDuration time.Duration
+	// MaxCost caps the cost in USD, computed from the duration with
+	// PricePerMinute; zero means no cap.
+	MaxCost float64
+	// PricePerMinute is the price of the transcription in USD per minute
+	// of audio. Zero means free, e.g. for local transcription.
+	PricePerMinute float64
+}
+
+func (b Budget) enabled() bool {
+	return b.MaxDuration > 0 || b.MaxCost > 0
+}
+
+// allows reports whether transcribing audio of duration d stays within b.
+func (b Budget) allows(d time.Duration) bool {
+	if b.MaxDuration > 0 && d > b.MaxDuration {
+		return false
+	}
+	return b.MaxCost <= 0 || b.cost(d) <= b.MaxCost
+}
+
+func (b Budget) cost(d time.Duration) float64 {
+	return d.Minutes() * b.PricePerMinute
+}
+
+// describe formats d and its cost, e.g. "42.5 min, $0.26".
+func (b Budget) describe(d time.Duration) string {
+	s := fmt.Sprintf("%.1f min", d.Minutes())
+	if b.PricePerMinute > 0 {
+		s += fmt.Sprintf(", $%.2f", b.cost(d))
+	}
+	return s
+}
+
+func (b Budget) String() string {
+	var limits []string
+	if b.MaxDuration > 0 {
+		limits = append(limits, fmt.Sprintf("%.1f min", b.MaxDuration.Minutes()))
+	}
+	if b.MaxCost > 0 {
+		limits = append(limits, fmt.Sprintf("$%.2f", b.MaxCost))
+	}
+	return strings.Join(limits, ", ")
+}
+
+// meter tracks the audio a run has used of its Budget. Only transcriptions
+// that succeed without a cached transcript count, so the meter waits for
+// the transcriptions in flight before refusing a voice message.
+type meter struct {
+	budget   Budget
+	mu       sync.Mutex
+	done     sync.Cond
+	used     time.Duration
+	inFlight time.Duration
+}
+
+func newMeter(budget Budget) *meter {
+	m := &meter{budget: budget}
+	m.done.L = &m.mu
+	return m
+}
+
+// start reserves audio of duration d for a transcription. It reports false,
+// with the audio used so far, if d doesn't fit into the budget.
+func (m *meter) start(d time.Duration) (bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for m.inFlight > 0 && !m.budget.allows(m.used+m.inFlight+d) {
+		m.done.Wait()
+	}
+	if !m.budget.allows(m.used + d) {
+		return false, m.used
+	}
+	m.inFlight += d
+	return true, m.used
+}
+
+// finish releases the audio reserved by start, counting it as used if the
+// audio was sent and transcribed.
+func (m *meter) finish(d time.Duration, used bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight -= d
+	if used {
+		m.used += d
+	}
+	m.done.Broadcast()
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudgetAllows(t *testing.T) {
+	tests := []struct {
+		name   string
+		budget Budget
+		d      time.Duration
+		want   bool
+	}{
+		{"no limits", Budget{}, 10 * time.Hour, true},
+		{"within duration", Budget{MaxDuration: 10 * time.Minute}, 10 * time.Minute, true},
+		{"over duration", Budget{MaxDuration: 10 * time.Minute}, 10*time.Minute + time.Second, false},
+		{"within cost", Budget{MaxCost: 0.06, PricePerMinute: 0.006}, 10 * time.Minute, true},
+		{"over cost", Budget{MaxCost: 0.06, PricePerMinute: 0.006}, 11 * time.Minute, false},
+		{"free", Budget{MaxCost: 0.01}, 10 * time.Hour, true},
+		{"cost within, duration over", Budget{MaxDuration: time.Minute, MaxCost: 1, PricePerMinute: 0.006}, 2 * time.Minute, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.budget.allows(tt.d); got != tt.want {
+				t.Errorf("allows(%v) = %v, want %v", tt.d, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMeterWaitsForTranscriptionsInFlight(t *testing.T) {
+	m := newMeter(Budget{MaxDuration: 3 * time.Minute})
+	if ok, _ := m.start(2 * time.Minute); !ok {
+		t.Fatal("start(2m) refused with an empty budget")
+	}
+
+	// 2m in flight and 2m more exceed the budget, unless the first turns
+	// out not to count.
+	result := make(chan bool)
+	go func() {
+		ok, _ := m.start(2 * time.Minute)
+		result <- ok
+	}()
+	select {
+	case <-result:
+		t.Fatal("start returned before the transcription in flight finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	m.finish(2*time.Minute, false)
+	if ok := <-result; !ok {
+		t.Error("start(2m) refused after the first transcription didn't count")
+	}
+
+	m.finish(2*time.Minute, true)
+	if ok, used := m.start(2 * time.Minute); ok || used != 2*time.Minute {
+		t.Errorf("start(2m) = %v, %v; want false, 2m", ok, used)
+	}
+}
@@ -2,9 +2,10 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
-	"os"
+	"sync"
 	"time"
 
 	"github.com/joern1811/wachat/internal/domain"
@@ -15,41 +16,334 @@ type ChatService struct {
 	parser      domain.ChatParser
 	transcriber domain.Transcriber
 	renderer    domain.ChatRenderer
+	state       domain.StateStore
+	prober      domain.AudioProber
 }
 
-func NewChatService(parser domain.ChatParser, transcriber domain.Transcriber, renderer domain.ChatRenderer) *ChatService {
+func NewChatService(parser domain.ChatParser, transcriber domain.Transcriber, renderer domain.ChatRenderer, state domain.StateStore, prober domain.AudioProber) *ChatService {
 	return &ChatService{
 		parser:      parser,
 		transcriber: transcriber,
 		renderer:    renderer,
+		state:       state,
+		prober:      prober,
 	}
 }
 
-// Process runs the full pipeline: parse → filter → transcribe → render.
-func (s *ChatService) Process(ctx context.Context, exportPath string, from, to *time.Time, w io.Writer) error {
-	chat, err := s.parser.Parse(exportPath)
+// Options controls a Process run.
+type Options struct {
+	// From and To limit the time range; nil means no lower/upper bound.
+	From, To *time.Time
+	// Incremental only handles messages newer than the last incremental
+	// run of the same chat, and records the last message afterwards. After
+	// a failed transcription, the message before it is recorded, so the
+	// next run retries it and repeats the messages following it.
+	Incremental bool
+	// Concurrency is the number of voice messages transcribed at the same
+	// time. Values below 1 mean 1.
+	Concurrency int
+
+	// Language is the spoken language as ISO-639-1 code; empty lets the
+	// transcriber detect it.
+	Language string
+	// Prompt is passed with every transcription.
+	Prompt string
+	// Vocabulary adds the participants' names and proper nouns from the
+	// preceding text messages to the prompt of each voice message.
+	Vocabulary bool
+
+	// Budget caps the audio transcribed in the run. Only transcriptions
+	// that succeed without the cache count. The run stops before the first
+	// voice message that would exceed it.
+	Budget Budget
+	// Confirm is asked whether to start a run whose estimated usage
+	// exceeds Budget. Nil refuses such runs.
+	Confirm func(estimate *Usage) bool
+	// CollectUsage fills Report.Usage, e.g. for a dry run.
+	CollectUsage bool
+}
+
+// Report summarizes a Process run.
+type Report struct {
+	// Transcribed counts the voice messages transcribed successfully.
+	Transcribed int
+	// Audio is the duration of the voice messages sent for transcription,
+	// as far as it could be read. Transcripts reused from the cache don't
+	// count. It is only tracked with Options.Budget.
+	Audio time.Duration
+	// Failed lists the voice messages that could not be transcribed. They
+	// are rendered without a transcript.
+	Failed []TranscriptionFailure
+	// Usage is the estimate made for Options.Budget, or else, with
+	// Options.CollectUsage, the voice messages of the messages rendered.
+	Usage *Usage
+}
+
+// TranscriptionFailure is a voice message whose transcription failed.
+type TranscriptionFailure struct {
+	MediaRef string
+	Err      error
+}
+
+// Process runs the full pipeline: parse → merge → filter → transcribe → render.
+// Messages flow through the pipeline one at a time, so output appears right
+// away and memory stays bounded. Voice messages are transcribed by a pool of
+// opts.Concurrency workers ahead of the output, which keeps the chat order.
+// Several exports of the same chat are merged into one, which requires
+// reading them completely first.
+//
+// With a budget, the usage is estimated up front and the run only starts
+// if it fits or opts.Confirm agrees. Exceeding the budget during the run
+// stops it like the end of the chat, with ErrBudgetExceeded.
+//
+// Failed transcriptions don't stop the run; they are listed in the report.
+// Only when the transcriber becomes unavailable altogether, the run stops
+// before the affected message.
+// The report is also returned along with an error, covering the messages
+// rendered up to that point.
+func (s *ChatService) Process(ctx context.Context, exportPaths []string, opts Options, w io.Writer) (*Report, error) {
+	var estimate *Usage
+	if opts.Budget.enabled() {
+		var err error
+		estimate, err = s.Estimate(ctx, exportPaths, opts)
+		if err != nil {
+			return nil, err
+		}
+		if !opts.Budget.allows(estimate.Duration) && (opts.Confirm == nil || !opts.Confirm(estimate)) {
+			return nil, fmt.Errorf("%w: %d voice message(s) with %s, budget %s",
+				ErrBudgetExceeded, estimate.VoiceMessages, opts.Budget.describe(estimate.Duration), opts.Budget)
+		}
+	}
+
+	chat, state, err := s.prepare(exportPaths, opts)
 	if err != nil {
-		return fmt.Errorf("parsing export: %w", err)
+		return nil, err
+	}
+	chatKey := chat.Meta.Title
+	if state == nil {
+		state = &domain.ProcessState{}
 	}
 
-	// Apply time filter before transcription to avoid unnecessary API calls
-	if from != nil || to != nil {
-		chat = chat.Filter(from, to)
+	if err := s.renderer.RenderHeader(w, &chat.Meta); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Usage: estimate}
+	collect := opts.CollectUsage && estimate == nil
+	if collect {
+		report.Usage = &Usage{}
+	}
+	// A failed transcription holds the state before its message, so the
+	// next incremental run retries it.
+	processed, failed := false, false
+	// Record progress even if the run is cut short: everything up to the
+	// last rendered message is in the output.
+	saveState := func() error {
+		if !opts.Incremental || !processed {
+			return nil
+		}
+		state.UpdatedAt = time.Now()
+		if err := s.state.Save(chatKey, state); err != nil {
+			return fmt.Errorf("saving state: %w", err)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue, wait := s.transcribe(ctx, chat, opts)
+	defer func() {
+		cancel()
+		for range queue {
+		}
+		wait()
+	}()
+
+	for item := range queue {
+		<-item.done
+		if item.streamErr != nil {
+			return report, errors.Join(item.streamErr, saveState())
+		}
+		if item.err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			// Failing every remaining voice message would only bury the
+			// cause.
+			if errors.Is(item.err, domain.ErrTranscriberUnavailable) {
+				return report, errors.Join(item.err, saveState())
+			}
+			report.Failed = append(report.Failed, TranscriptionFailure{MediaRef: item.msg.MediaRef, Err: item.err})
+			failed = true
+		} else if needsTranscription(&item.msg) {
+			report.Transcribed++
+			if opts.Budget.enabled() && !item.msg.Transcript.Cached {
+				report.Audio += item.audio
+			}
+		}
+		if collect && needsTranscription(&item.msg) {
+			report.Usage.add(item.msg.Sender, item.audio, item.audioErr == nil)
+		}
+
+		if err := s.renderer.RenderMessage(w, &item.msg); err != nil {
+			return report, errors.Join(err, saveState())
+		}
+		if !failed {
+			state.Advance(&item.msg)
+			processed = true
+		}
 	}
 
-	// Transcribe voice messages
-	for i := range chat.Messages {
-		if chat.Messages[i].Type != domain.VoiceMessage {
-			continue
+	// The queue also ends early when ctx is canceled.
+	return report, errors.Join(ctx.Err(), saveState())
+}
+
+// lookahead bounds how many messages are read ahead of the output while
+// voice messages are being transcribed.
+const lookahead = 256
+
+// pending is a message on its way to the renderer. done is closed once its
+// transcription (if any) has finished.
+type pending struct {
+	msg       domain.Message
+	audio     time.Duration // duration of a voice message
+	audioErr  error         // reading the duration failed
+	err       error         // transcription error
+	streamErr error         // error reading the chat; ends the queue
+	done      chan struct{}
+}
+
+// transcribe reads the chat in a separate goroutine and starts transcribing
+// voice messages on up to opts.Concurrency workers. The returned queue yields
+// the messages in chat order; it is closed at the end of the chat, when ctx
+// is canceled or when opts.Budget is used up. wait blocks until all
+// goroutines have finished.
+func (s *ChatService) transcribe(ctx context.Context, chat *domain.ChatStream, opts Options) (queue <-chan *pending, wait func()) {
+	out := make(chan *pending, lookahead)
+	sem := make(chan struct{}, max(opts.Concurrency, 1))
+	vocab := newVocabulary(chat.Meta.Participants)
+	meter := newMeter(opts.Budget)
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		defer close(out)
+		for msg, err := range chat.Messages {
+			var (
+				audio    time.Duration
+				audioErr error
+			)
+			// The duration is only read when it is needed, as it means
+			// reading the attachment's headers. Unknown durations count
+			// as zero.
+			if err == nil && needsTranscription(&msg) && (opts.Budget.enabled() || opts.CollectUsage) {
+				audio, audioErr = s.prober.Duration(chat.Media, msg.MediaRef)
+			}
+			if err == nil && needsTranscription(&msg) {
+				if ok, used := meter.start(audio); !ok {
+					err = fmt.Errorf("%w: stopped before %s after %s, budget %s",
+						ErrBudgetExceeded, msg.MediaRef, opts.Budget.describe(used), opts.Budget)
+				}
+			}
+
+			item := &pending{msg: msg, audio: audio, audioErr: audioErr, streamErr: err, done: make(chan struct{})}
+			vocab.observe(&msg)
+
+			if err == nil && needsTranscription(&msg) {
+				req := domain.TranscriptionRequest{
+					Media:    chat.Media,
+					Path:     msg.MediaRef,
+					Language: opts.Language,
+					Prompt:   opts.Prompt,
+					Duration: audio,
+				}
+				if opts.Vocabulary {
+					req.Prompt = vocab.prompt(opts.Prompt)
+				}
+
+				select {
+				case sem <- struct{}{}:
+				case <-ctx.Done():
+					meter.finish(audio, false)
+					return
+				}
+				wg.Go(func() {
+					defer func() {
+						<-sem
+						close(item.done)
+					}()
+					transcript, err := s.transcriber.Transcribe(ctx, req)
+					meter.finish(audio, err == nil && !transcript.Cached)
+					if err != nil {
+						item.err = err
+						return
+					}
+					item.msg.Content = transcript.Text
+					item.msg.Transcript = transcript
+				})
+			} else {
+				close(item.done)
+			}
+
+			select {
+			case out <- item:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
 		}
+	})
+
+	return out, wg.Wait
+}
+
+func needsTranscription(msg *domain.Message) bool {
+	return msg.Type == domain.VoiceMessage && !msg.MediaMissing
+}
 
-		text, err := s.transcriber.Transcribe(ctx, chat.Messages[i].MediaRef)
+// prepare opens the exports and restricts them to the messages selected by
+// opts. For incremental runs it also returns the stored state, if any.
+func (s *ChatService) prepare(exportPaths []string, opts Options) (*domain.ChatStream, *domain.ProcessState, error) {
+	chat, err := s.open(exportPaths)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var state *domain.ProcessState
+	if opts.Incremental {
+		state, err = s.state.Load(chat.Meta.Title)
+		if err != nil {
+			return nil, nil, fmt.Errorf("loading state: %w", err)
+		}
+		chat = chat.Since(state)
+	}
+
+	// Apply time filter before transcription to avoid unnecessary API calls
+	if opts.From != nil || opts.To != nil {
+		chat = chat.Filter(domain.InRange(opts.From, opts.To))
+	}
+	return chat, state, nil
+}
+
+// open streams a single export directly. Several exports are parsed
+// completely and merged.
+func (s *ChatService) open(exportPaths []string) (*domain.ChatStream, error) {
+	if len(exportPaths) == 1 {
+		chat, err := s.parser.Stream(exportPaths[0])
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Warning: transcription failed for %s: %v\n", chat.Messages[i].MediaRef, err)
-			continue
+			return nil, fmt.Errorf("parsing export %s: %w", exportPaths[0], err)
 		}
-		chat.Messages[i].Content = text
+		return chat, nil
 	}
 
-	return s.renderer.Render(w, chat)
+	chats := make([]*domain.Chat, 0, len(exportPaths))
+	for _, path := range exportPaths {
+		chat, err := s.parser.Parse(path)
+		if err != nil {
+			return nil, fmt.Errorf("parsing export %s: %w", path, err)
+		}
+		chats = append(chats, chat)
+	}
+	return domain.Merge(chats...).Stream(), nil
 }
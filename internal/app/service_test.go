@@ -0,0 +1,280 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+type fakeParser struct {
+	chat *domain.Chat
+}
+
+func (p *fakeParser) Parse(string) (*domain.Chat, error) {
+	return p.chat, nil
+}
+
+func (p *fakeParser) Stream(string) (*domain.ChatStream, error) {
+	return p.chat.Stream(), nil
+}
+
+// fakeTranscriber transcribes every voice message to its path, unless it is
+// listed in errs or cached.
+type fakeTranscriber struct {
+	errs   map[string]error
+	cached []string
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeTranscriber) Transcribe(_ context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, req.Path)
+	f.mu.Unlock()
+
+	if err := f.errs[req.Path]; err != nil {
+		return nil, err
+	}
+	return &domain.Transcript{Text: "transcript of " + req.Path, Cached: slices.Contains(f.cached, req.Path)}, nil
+}
+
+type fakeProber map[string]time.Duration
+
+func (p fakeProber) Duration(_ fs.FS, path string) (time.Duration, error) {
+	d, ok := p[path]
+	if !ok {
+		return 0, errors.New("unknown duration")
+	}
+	return d, nil
+}
+
+// lineRenderer renders each message as "sender: content".
+type lineRenderer struct{}
+
+func (lineRenderer) RenderHeader(io.Writer, *domain.Metadata) error { return nil }
+
+func (lineRenderer) RenderMessage(w io.Writer, msg *domain.Message) error {
+	_, err := fmt.Fprintf(w, "%s: %s\n", msg.Sender, msg.Content)
+	return err
+}
+
+type memoryState map[string]*domain.ProcessState
+
+func (m memoryState) Load(chatKey string) (*domain.ProcessState, error) {
+	return m[chatKey], nil
+}
+
+func (m memoryState) Save(chatKey string, state *domain.ProcessState) error {
+	saved := *state
+	m[chatKey] = &saved
+	return nil
+}
+
+var testStart = time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+
+// testChat builds a chat from "text" and "voice.opus" contents, one minute
+// apart. Contents ending in ".opus" become voice messages.
+func testChat(contents ...string) *domain.Chat {
+	chat := &domain.Chat{Meta: domain.Metadata{Title: "Anna"}}
+	for i, c := range contents {
+		msg := domain.Message{
+			Timestamp: testStart.Add(time.Duration(i) * time.Minute),
+			Sender:    "Anna",
+			Content:   c,
+		}
+		if strings.HasSuffix(c, ".opus") {
+			msg.Type = domain.VoiceMessage
+			msg.MediaRef = c
+		}
+		chat.Messages = append(chat.Messages, msg)
+	}
+	return chat
+}
+
+func TestProcessBudget(t *testing.T) {
+	durations := fakeProber{"a.opus": time.Minute, "b.opus": 2 * time.Minute, "c.opus": time.Minute}
+	chat := testChat("hallo", "a.opus", "b.opus", "tschüss", "c.opus")
+
+	tests := []struct {
+		name        string
+		budget      Budget
+		confirm     bool
+		concurrency int
+		errs        map[string]error
+		cached      []string
+
+		wantErr         error
+		wantConfirm     bool
+		wantCalls       []string
+		wantTranscribed int
+		wantAudio       time.Duration
+		wantLines       int
+	}{
+		{
+			name:            "within budget",
+			budget:          Budget{MaxDuration: 4 * time.Minute},
+			wantCalls:       []string{"a.opus", "b.opus", "c.opus"},
+			wantTranscribed: 3,
+			wantAudio:       4 * time.Minute,
+			wantLines:       5,
+		},
+		{
+			name:        "refused up front",
+			budget:      Budget{MaxDuration: 3 * time.Minute},
+			wantErr:     ErrBudgetExceeded,
+			wantConfirm: true,
+		},
+		{
+			name:            "confirmed, stops when used up",
+			budget:          Budget{MaxDuration: 3 * time.Minute},
+			confirm:         true,
+			wantErr:         ErrBudgetExceeded,
+			wantConfirm:     true,
+			wantCalls:       []string{"a.opus", "b.opus"},
+			wantTranscribed: 2,
+			wantAudio:       3 * time.Minute,
+			wantLines:       4,
+		},
+		{
+			name:            "stops by cost",
+			budget:          Budget{MaxCost: 0.01, PricePerMinute: 0.006},
+			confirm:         true,
+			wantErr:         ErrBudgetExceeded,
+			wantConfirm:     true,
+			wantCalls:       []string{"a.opus"},
+			wantTranscribed: 1,
+			wantAudio:       time.Minute,
+			wantLines:       2,
+		},
+		{
+			name:            "cached transcripts don't count",
+			budget:          Budget{MaxDuration: 3 * time.Minute},
+			confirm:         true,
+			cached:          []string{"b.opus"},
+			wantConfirm:     true,
+			wantCalls:       []string{"a.opus", "b.opus", "c.opus"},
+			wantTranscribed: 3,
+			wantAudio:       2 * time.Minute,
+			wantLines:       5,
+		},
+		{
+			name:            "failed transcriptions don't count",
+			budget:          Budget{MaxDuration: 3 * time.Minute},
+			confirm:         true,
+			errs:            map[string]error{"b.opus": errors.New("bad request")},
+			wantConfirm:     true,
+			wantCalls:       []string{"a.opus", "b.opus", "c.opus"},
+			wantTranscribed: 2,
+			wantAudio:       2 * time.Minute,
+			wantLines:       5,
+		},
+		{
+			name:            "concurrent, cached transcripts don't count",
+			budget:          Budget{MaxDuration: 3 * time.Minute},
+			confirm:         true,
+			concurrency:     3,
+			cached:          []string{"a.opus", "b.opus"},
+			wantConfirm:     true,
+			wantCalls:       []string{"a.opus", "b.opus", "c.opus"},
+			wantTranscribed: 3,
+			wantAudio:       time.Minute,
+			wantLines:       5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := &fakeTranscriber{errs: tt.errs, cached: tt.cached}
+			svc := NewChatService(&fakeParser{chat: chat}, tr, lineRenderer{}, memoryState{}, durations)
+
+			confirmed := false
+			opts := Options{
+				Budget:      tt.budget,
+				Concurrency: tt.concurrency,
+				Confirm: func(estimate *Usage) bool {
+					confirmed = true
+					if estimate.Duration != 4*time.Minute {
+						t.Errorf("estimate = %v, want 4m", estimate.Duration)
+					}
+					return tt.confirm
+				},
+			}
+
+			var out strings.Builder
+			report, err := svc.Process(t.Context(), []string{"export"}, opts, &out)
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Process() error = %v, want %v", err, tt.wantErr)
+			}
+			if confirmed != tt.wantConfirm {
+				t.Errorf("Confirm called = %v, want %v", confirmed, tt.wantConfirm)
+			}
+			slices.Sort(tr.calls)
+			if !slices.Equal(tr.calls, tt.wantCalls) {
+				t.Errorf("transcribed %v, want %v", tr.calls, tt.wantCalls)
+			}
+			if lines := strings.Count(out.String(), "\n"); lines != tt.wantLines {
+				t.Errorf("rendered %d messages, want %d:\n%s", lines, tt.wantLines, out.String())
+			}
+			if report == nil {
+				if tt.wantTranscribed > 0 {
+					t.Fatal("no report")
+				}
+				return
+			}
+			if report.Transcribed != tt.wantTranscribed {
+				t.Errorf("Transcribed = %d, want %d", report.Transcribed, tt.wantTranscribed)
+			}
+			if report.Audio != tt.wantAudio {
+				t.Errorf("Audio = %v, want %v", report.Audio, tt.wantAudio)
+			}
+		})
+	}
+}
+
+func TestProcessHoldsStateBeforeFailure(t *testing.T) {
+	chat := testChat("hallo", "a.opus", "b.opus", "tschüss")
+	tr := &fakeTranscriber{errs: map[string]error{"b.opus": errors.New("bad request")}}
+	state := memoryState{}
+	svc := NewChatService(&fakeParser{chat: chat}, tr, lineRenderer{}, state, fakeProber{})
+
+	report, err := svc.Process(t.Context(), []string{"export"}, Options{Incremental: true}, io.Discard)
+	if err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if len(report.Failed) != 1 || report.Failed[0].MediaRef != "b.opus" {
+		t.Errorf("Failed = %v, want b.opus", report.Failed)
+	}
+
+	saved := state["Anna"]
+	if saved == nil {
+		t.Fatal("no state saved")
+	}
+	if want := chat.Messages[1]; !saved.LastTimestamp.Equal(want.Timestamp) || saved.LastHash != want.Hash() {
+		t.Errorf("state saved at %v, want a.opus at %v", saved.LastTimestamp, want.Timestamp)
+	}
+}
+
+func TestProcessStopsWhenTranscriberUnavailable(t *testing.T) {
+	chat := testChat("hallo", "a.opus", "b.opus", "tschüss")
+	tr := &fakeTranscriber{errs: map[string]error{"a.opus": domain.ErrTranscriberUnavailable}}
+	svc := NewChatService(&fakeParser{chat: chat}, tr, lineRenderer{}, memoryState{}, fakeProber{})
+
+	var out strings.Builder
+	_, err := svc.Process(t.Context(), []string{"export"}, Options{}, &out)
+	if !errors.Is(err, domain.ErrTranscriberUnavailable) {
+		t.Fatalf("Process() error = %v, want ErrTranscriberUnavailable", err)
+	}
+	if got, want := out.String(), "Anna: hallo\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Usage is the transcription workload of a run: the voice messages that
+// would be transcribed and their total duration.
+type Usage struct {
+	VoiceMessages int
+	Duration      time.Duration
+	// Unknown counts the voice messages whose duration couldn't be read.
+	// They are not included in Duration.
+	Unknown int
+	// BySender breaks the usage down per sender, in order of their first
+	// voice message.
+	BySender []SenderUsage
+}
+
+// SenderUsage is the part of a Usage sent by one participant.
+type SenderUsage struct {
+	Sender        string
+	VoiceMessages int
+	Duration      time.Duration
+	Unknown       int
+}
+
+// add counts a voice message of sender with duration d; known reports
+// whether d could be read.
+func (u *Usage) add(sender string, d time.Duration, known bool) {
+	i := slices.IndexFunc(u.BySender, func(s SenderUsage) bool { return s.Sender == sender })
+	if i < 0 {
+		i = len(u.BySender)
+		u.BySender = append(u.BySender, SenderUsage{Sender: sender})
+	}
+	s := &u.BySender[i]
+
+	u.VoiceMessages++
+	s.VoiceMessages++
+	if !known {
+		u.Unknown++
+		s.Unknown++
+		return
+	}
+	u.Duration += d
+	s.Duration += d
+}
+
+// Estimate computes the usage a Process run with the same exports and
+// options would cause, from the container headers of the voice messages.
+// Nothing is transcribed.
+func (s *ChatService) Estimate(ctx context.Context, exportPaths []string, opts Options) (*Usage, error) {
+	chat, _, err := s.prepare(exportPaths, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &Usage{}
+	for msg, err := range chat.Messages {
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !needsTranscription(&msg) {
+			continue
+		}
+		d, err := s.prober.Duration(chat.Media, msg.MediaRef)
+		usage.add(msg.Sender, d, err == nil)
+	}
+	return usage, nil
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+const (
+	// vocabularyWindow is the number of recent text messages proper nouns
+	// are collected from.
+	vocabularyWindow = 50
+	// vocabularyWords caps the proper nouns in a prompt.
+	vocabularyWords = 30
+	// maxPromptLen keeps prompts well below Whisper's limit of 224 tokens.
+	maxPromptLen = 600
+)
+
+// vocabulary collects words that speech recognition tends to get wrong: the
+// participants' names and proper nouns that recur in the recent text
+// messages of the chat.
+type vocabulary struct {
+	names  []string
+	recent [][]string // proper nouns of the last text messages, oldest first
+	counts map[string]int
+}
+
+func newVocabulary(participants []string) *vocabulary {
+	return &vocabulary{names: participants, counts: make(map[string]int)}
+}
+
+// observe adds a message to the window of recent messages.
+func (v *vocabulary) observe(msg *domain.Message) {
+	if msg.Type != domain.TextMessage || msg.Deleted {
+		return
+	}
+
+	words := properNouns(msg.Content)
+	v.recent = append(v.recent, words)
+	for _, w := range words {
+		v.counts[w]++
+	}
+
+	if len(v.recent) > vocabularyWindow {
+		for _, w := range v.recent[0] {
+			if v.counts[w]--; v.counts[w] == 0 {
+				delete(v.counts, w)
+			}
+		}
+		v.recent = v.recent[1:]
+	}
+}
+
+// prompt returns base followed by the participants' names and the recent
+// proper nouns, most frequent first.
+func (v *vocabulary) prompt(base string) string {
+	var words []string
+	for w := range v.counts {
+		if !slices.Contains(v.names, w) {
+			words = append(words, w)
+		}
+	}
+	slices.SortFunc(words, func(a, b string) int {
+		if c := cmp.Compare(v.counts[b], v.counts[a]); c != 0 {
+			return c
+		}
+		return strings.Compare(a, b)
+	})
+	if len(words) > vocabularyWords {
+		words = words[:vocabularyWords]
+	}
+
+	prompt, sep := base, " "
+	if base == "" {
+		sep = ""
+	}
+	for _, w := range slices.Concat(v.names, words) {
+		if len(prompt)+len(sep)+len(w) > maxPromptLen {
+			break
+		}
+		prompt += sep + w
+		sep = ", "
+	}
+	return prompt
+}
+
+// commonCapitalized are capitalized words that are no proper nouns.
+var commonCapitalized = map[string]bool{
+	"Ich": true, "Sie": true, "Ihr": true, "Ihre": true, "Ihnen": true, "Ihren": true,
+	"OK": true, "Ok": true, "I'm": true, "I'll": true, "I've": true, "I'd": true,
+}
+
+// properNouns returns the words of a text that are likely names: capitalized
+// words that don't start a sentence, and words mixing case or digits such as
+// "iPhone" or "A380". For German, this includes common nouns, which are
+// harmless in a prompt.
+func properNouns(text string) []string {
+	var nouns []string
+	sentenceStart := true
+	for _, field := range strings.Fields(text) {
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		start := sentenceStart
+		sentenceStart = strings.ContainsAny(field[len(field)-1:], ".!?:")
+
+		if utf8.RuneCountInString(word) < 3 || strings.ContainsAny(word, "/@") || commonCapitalized[word] {
+			continue
+		}
+		if mixedCase(word) || (!start && startsUpper(word)) {
+			nouns = append(nouns, word)
+		}
+	}
+	return nouns
+}
+
+func startsUpper(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return unicode.IsUpper(r)
+}
+
+// mixedCase reports words like "iPhone", "WhatsApp" or "A380".
+func mixedCase(word string) bool {
+	var upper, lower, digit int
+	for i, r := range word {
+		switch {
+		case unicode.IsUpper(r) && i > 0:
+			upper++
+		case unicode.IsLower(r):
+			lower++
+		case unicode.IsDigit(r):
+			digit++
+		}
+	}
+	return lower > 0 && upper > 0 || digit > 0 && digit < utf8.RuneCountInString(word)
+}
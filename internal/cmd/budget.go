@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joern1811/wachat/internal/adapter/transcriber"
+	"github.com/joern1811/wachat/internal/app"
+)
+
+// newBudget builds the budget given with --max-cost and --max-audio-minutes,
+// priced for the selected transcriber.
+func newBudget() (app.Budget, error) {
+	if maxCost < 0 || maxAudioMinutes < 0 {
+		return app.Budget{}, fmt.Errorf("--max-cost and --max-audio-minutes must not be negative")
+	}
+	budget := app.Budget{
+		MaxDuration: time.Duration(maxAudioMinutes * float64(time.Minute)),
+		MaxCost:     maxCost,
+	}
+
+	// Local transcription is free. In a chain with OpenAI, every message
+	// may end up there.
+	if usesBackend("openai") {
+		price, ok := transcriber.PriceOf(model)
+		if !ok && maxCost > 0 {
+			return app.Budget{}, fmt.Errorf("--max-cost: no known price for model %q, use --max-audio-minutes instead", model)
+		}
+		budget.PricePerMinute = price.PerMinute
+	}
+	return budget, nil
+}
+
+// confirmBudget returns the question asked when the estimated usage exceeds
+// budget. Without a terminal to ask on, such runs are refused. A dry run
+// only notes what the run would ask.
+func confirmBudget(budget app.Budget) func(*app.Usage) bool {
+	describe := func(u *app.Usage) string {
+		s := fmt.Sprintf("%d voice message(s) with %.1f min", u.VoiceMessages, u.Duration.Minutes())
+		if budget.PricePerMinute > 0 {
+			s += fmt.Sprintf(" ($%.2f)", u.Duration.Minutes()*budget.PricePerMinute)
+		}
+		return s
+	}
+
+	if dryRun {
+		return func(u *app.Usage) bool {
+			fmt.Fprintf(os.Stderr, "[dry-run] %s exceed the budget of %s; the run would ask for confirmation\n", describe(u), budget)
+			return true
+		}
+	}
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return nil
+	}
+	return func(u *app.Usage) bool {
+		fmt.Fprintf(os.Stderr, "%s exceed the budget of %s.\n", describe(u), budget)
+		fmt.Fprint(os.Stderr, "Continue and stop when the budget is used up? [y/N]: ")
+		var answer string
+		fmt.Scanln(&answer) //nolint:gosec // interactive CLI input, error not actionable
+		answer = strings.ToLower(answer)
+		return answer == "y" || answer == "yes"
+	}
+}
+
+// printBudget shows how much of the budget a run used.
+func printBudget(budget app.Budget, report *app.Report) {
+	if report == nil || (budget.MaxDuration <= 0 && budget.MaxCost <= 0) {
+		return
+	}
+	used := fmt.Sprintf("%.1f min", report.Audio.Minutes())
+	if budget.PricePerMinute > 0 {
+		used += fmt.Sprintf(" ($%.2f)", report.Audio.Minutes()*budget.PricePerMinute)
+	}
+	fmt.Fprintf(os.Stderr, "Transcription budget: used %s of %s\n", used, budget)
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var pruneOlderThan string
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the transcription cache",
+	Long: `Transcripts are cached by the content of the audio file and the
+transcription settings, so re-running wachat on the same voice messages
+doesn't send them again. The cache lives in $XDG_CACHE_HOME/wachat.`,
+}
+
+var cacheStatsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Show the number and size of cached transcripts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store := transcriptCache()
+		st, err := store.Stats()
+		if err != nil {
+			return fmt.Errorf("reading cache: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+		fmt.Fprintf(out, "Location: %s\n", store.Dir)
+		fmt.Fprintf(out, "Entries:  %d\n", st.Entries)
+		fmt.Fprintf(out, "Size:     %.1f KB\n", float64(st.Bytes)/1024)
+		if st.Entries > 0 {
+			fmt.Fprintf(out, "Last use: %s (oldest) to %s (newest)\n",
+				st.Oldest.Format("02.01.2006 15:04"), st.Newest.Format("02.01.2006 15:04"))
+		}
+		return nil
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached transcripts that were not used recently",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		age, err := parseAge(pruneOlderThan)
+		if err != nil {
+			return fmt.Errorf("parsing --older-than: %w", err)
+		}
+
+		n, err := transcriptCache().Prune(time.Now().Add(-age))
+		if err != nil {
+			return fmt.Errorf("pruning cache: %w", err)
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "Removed %d cached transcript(s)\n", n)
+		return nil
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached transcripts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := transcriptCache().Clear(); err != nil {
+			return fmt.Errorf("clearing cache: %w", err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), "Cache cleared")
+		return nil
+	},
+}
+
+func init() {
+	cachePruneCmd.Flags().StringVar(&pruneOlderThan, "older-than", "90d", `Remove entries unused for this long (e.g. "30d" or "12h")`)
+	cacheCmd.AddCommand(cacheStatsCmd, cachePruneCmd, cacheClearCmd)
+	rootCmd.AddCommand(cacheCmd)
+}
+
+// parseAge parses a Go duration, additionally accepting whole days ("30d").
+func parseAge(s string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -18,11 +18,18 @@ var initCmd = &cobra.Command{
 	Short: "Create config file with OpenAI API key",
 	Long: `Interactively creates the wachat config file.
 Prompts for an OpenAI API key, validates it against the API,
-and writes the config to ~/.config/wachat/config.json.`,
+and writes the config to ~/.config/wachat/config.json.
+
+With --base-url, the key is validated against that OpenAI-compatible
+server instead, and the URL is saved as well. Self-hosted servers may
+not need a key. Other settings in an existing config are kept.`,
 	RunE: runInit,
 }
 
+var initBaseURL string
+
 func init() {
+	initCmd.Flags().StringVar(&initBaseURL, "base-url", "", "Base URL of an OpenAI-compatible API to use instead of OpenAI")
 	rootCmd.AddCommand(initCmd)
 }
 
@@ -31,9 +38,13 @@ func runInit(cmd *cobra.Command, _ []string) error {
 	configPath := filepath.Join(dir, "config.json")
 
 	existingKey := ""
+	cfg := map[string]any{}
 
 	if _, err := os.Stat(configPath); err == nil {
-		existingKey, _ = readExistingKey(configPath)
+		if existing, err := readConfig(configPath); err == nil {
+			cfg = existing
+			existingKey, _ = cfg["openai_api_key"].(string)
+		}
 
 		fmt.Fprintf(cmd.OutOrStdout(), "Config already exists at %s\n", configPath)
 		fmt.Fprint(cmd.OutOrStdout(), "Overwrite? [y/N]: ")
@@ -46,13 +57,12 @@ func runInit(cmd *cobra.Command, _ []string) error {
 		}
 	}
 
-	prompt := "OpenAI API Key: "
+	keyPrompt := "OpenAI API Key: "
 	if existingKey != "" {
-		masked := existingKey[:7] + "***" + existingKey[len(existingKey)-3:]
-		prompt = fmt.Sprintf("OpenAI API Key [%s]: ", masked)
+		keyPrompt = fmt.Sprintf("OpenAI API Key [%s]: ", maskKey(existingKey))
 	}
 
-	fmt.Fprint(cmd.OutOrStdout(), prompt)
+	fmt.Fprint(cmd.OutOrStdout(), keyPrompt)
 
 	var apiKey string
 	fmt.Scanln(&apiKey) //nolint:gosec // interactive CLI input, error not actionable
@@ -61,13 +71,17 @@ func runInit(cmd *cobra.Command, _ []string) error {
 		apiKey = existingKey
 	}
 
-	if apiKey == "" {
+	if apiKey == "" && initBaseURL == "" {
 		return fmt.Errorf("API key must not be empty")
 	}
 
-	fmt.Fprint(cmd.OutOrStdout(), "Validating API key... ")
+	if initBaseURL != "" {
+		fmt.Fprintf(cmd.OutOrStdout(), "Validating API key against %s... ", initBaseURL)
+	} else {
+		fmt.Fprint(cmd.OutOrStdout(), "Validating API key... ")
+	}
 
-	if err := validateAPIKey(cmd.Context(), apiKey); err != nil {
+	if err := validateAPIKey(cmd.Context(), apiKey, initBaseURL); err != nil {
 		fmt.Fprintln(cmd.OutOrStdout(), "FAILED")
 		return fmt.Errorf("invalid API key: %w", err)
 	}
@@ -78,7 +92,12 @@ func runInit(cmd *cobra.Command, _ []string) error {
 		return fmt.Errorf("creating config directory: %w", err)
 	}
 
-	data, err := json.MarshalIndent(map[string]string{"openai_api_key": apiKey}, "", "  ")
+	cfg["openai_api_key"] = apiKey
+	if initBaseURL != "" {
+		cfg["openai_base_url"] = initBaseURL
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshaling config: %w", err)
 	}
@@ -91,22 +110,36 @@ func runInit(cmd *cobra.Command, _ []string) error {
 	return nil
 }
 
-func readExistingKey(path string) (string, error) {
+func readConfig(path string) (map[string]any, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	var cfg map[string]string
+	var cfg map[string]any
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return cfg["openai_api_key"], nil
+	return cfg, nil
 }
 
-func validateAPIKey(ctx context.Context, apiKey string) error {
-	client := openai.NewClient(option.WithAPIKey(apiKey))
+// maskKey hides all but the start and end of an API key.
+func maskKey(key string) string {
+	if len(key) < 12 {
+		return "***"
+	}
+	return key[:7] + "***" + key[len(key)-3:]
+}
+
+// validateAPIKey lists the models, which any OpenAI-compatible server
+// supports and which fails for an invalid key.
+func validateAPIKey(ctx context.Context, apiKey, baseURL string) error {
+	opts := []option.RequestOption{option.WithAPIKey(apiKey)}
+	if baseURL != "" {
+		opts = append(opts, option.WithBaseURL(baseURL))
+	}
+	client := openai.NewClient(opts...)
 
 	_, err := client.Models.List(ctx)
 	return err
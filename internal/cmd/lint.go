@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/joern1811/wachat/internal/adapter/parser"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint <export>",
+	Short: "Check a chat export for parser problems",
+	Long: `Parses a WhatsApp export and reports problems the parser would otherwise
+handle silently: lines that look like message headers but do not match the
+detected format, unparseable dates, timestamps going backwards, text before
+the first message and referenced media missing from the export.
+
+Exits with a non-zero status if any problems were found.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runLint,
+}
+
+func init() {
+	lintCmd.Flags().StringVar(&locale, "locale", "", "Export locale instead of auto-detection")
+	lintCmd.Flags().StringVar(&timezone, "timezone", "", "Time zone the export was written in (default: system local)")
+	rootCmd.AddCommand(lintCmd)
+}
+
+func runLint(cmd *cobra.Command, args []string) error {
+	loc, err := loadLocation(timezone, time.Local)
+	if err != nil {
+		return fmt.Errorf("parsing --timezone: %w", err)
+	}
+
+	p := &parser.WhatsAppParser{Locale: locale, Location: loc}
+	defer p.Cleanup()
+
+	chat, err := p.Parse(args[0])
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Detected format: %s\n", p.Detection)
+	for _, d := range p.Diagnostics {
+		fmt.Fprintln(out, d)
+	}
+	fmt.Fprintf(out, "%d message(s), %d problem(s)\n", len(chat.Messages), len(p.Diagnostics))
+
+	if len(p.Diagnostics) > 0 {
+		cmd.SilenceUsage = true
+		return fmt.Errorf("found %d problem(s)", len(p.Diagnostics))
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <export> <export>...",
+	Short: "Merge several overlapping exports of the same chat",
+	Long: `Parses several exports of the same chat (e.g. re-exported every few months)
+and renders them as one continuous chat. Messages contained in more than one
+export appear once; attachments are taken from whichever export contains
+them.
+
+Accepts the same flags as the root command.`,
+	Args: cobra.MinimumNArgs(2),
+	RunE: runRoot,
+}
+
+func init() {
+	addProcessFlags(mergeCmd)
+	rootCmd.AddCommand(mergeCmd)
+}
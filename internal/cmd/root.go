@@ -5,15 +5,20 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"text/tabwriter"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"github.com/joern1811/wachat/internal/adapter/audio"
+	"github.com/joern1811/wachat/internal/adapter/cache"
 	"github.com/joern1811/wachat/internal/adapter/parser"
 	"github.com/joern1811/wachat/internal/adapter/renderer"
+	"github.com/joern1811/wachat/internal/adapter/state"
 	"github.com/joern1811/wachat/internal/adapter/transcriber"
 	"github.com/joern1811/wachat/internal/app"
 	"github.com/joern1811/wachat/internal/domain"
@@ -25,15 +30,45 @@ var (
 	output  string
 	format  string
 	dryRun  bool
+	locale  string
+	detect  bool
+
+	hideDeleted bool
+	hideEvents  []string
+
+	timezone        string
+	outputTimezone  string
+	strict          bool
+	incremental     bool
+	concurrency     int
+	maxRetries      int
+	rpm             int
+	noCache         bool
+	maxCost         float64
+	maxAudioMinutes float64
+	backend         string
+
+	openaiBaseURL string
+	model         string
+	language      string
+	prompt        string
+	temperature   float64
+	timeout       time.Duration
+	noVocabulary  bool
+
+	voiceTimestamps bool
 )
 
 var rootCmd = &cobra.Command{
-	Use:   "wachat <export.zip>",
+	Use:   "wachat <export>...",
 	Short: "Convert WhatsApp chat exports to readable text",
-	Long: `wachat processes WhatsApp chat exports (.zip files) and converts them
-to readable text or markdown. Voice messages are automatically transcribed
-using the OpenAI Whisper API.`,
-	Args: cobra.ExactArgs(1),
+	Long: `wachat processes WhatsApp chat exports and converts them to readable
+text or markdown. The export can be the .zip file, an extracted directory
+or the bare chat .txt file. Voice messages are automatically transcribed
+using the OpenAI Whisper API.
+
+Several exports of the same chat are merged into one (see "wachat merge").`,
+	Args: cobra.MinimumNArgs(1),
 	RunE: runRoot,
 }
 
@@ -46,11 +81,41 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	rootCmd.Flags().StringVar(&fromStr, "from", "", `Start time filter (format: "DD.MM.YYYY" or "DD.MM.YYYY HH:MM")`)
-	rootCmd.Flags().StringVar(&toStr, "to", "", `End time filter (format: "DD.MM.YYYY" or "DD.MM.YYYY HH:MM")`)
-	rootCmd.Flags().StringVarP(&output, "output", "o", "", "Output file (default: stdout)")
-	rootCmd.Flags().StringVarP(&format, "format", "f", "text", `Output format: "text" or "markdown"`)
-	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what API calls would be made without executing them")
+	addProcessFlags(rootCmd)
+}
+
+// addProcessFlags registers the flags of the processing pipeline, shared by
+// the root and merge commands.
+func addProcessFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringVar(&fromStr, "from", "", `Start time filter (format: "DD.MM.YYYY" or "DD.MM.YYYY HH:MM")`)
+	f.StringVar(&toStr, "to", "", `End time filter (format: "DD.MM.YYYY" or "DD.MM.YYYY HH:MM")`)
+	f.StringVarP(&output, "output", "o", "", "Output file (default: stdout)")
+	f.StringVarP(&format, "format", "f", "text", `Output format: "text", "markdown" or "html"`)
+	f.BoolVar(&voiceTimestamps, "voice-timestamps", false, `Mark voice message transcripts with positions in the audio, e.g. "[0:42]"`)
+	f.BoolVar(&dryRun, "dry-run", false, "Show what API calls would be made and estimate their cost, without executing them")
+	f.StringVar(&locale, "locale", "", fmt.Sprintf("Export locale instead of auto-detection (%s)", strings.Join(parser.LocaleNames(), ", ")))
+	f.BoolVar(&detect, "detect", false, "Print the detected export format and exit")
+	f.BoolVar(&strict, "strict", false, `Fail on any parser problem (see "wachat lint")`)
+	f.BoolVar(&hideDeleted, "hide-deleted", false, "Omit messages that were deleted by their sender")
+	f.StringVar(&timezone, "timezone", "", `Time zone the export was written in, e.g. "Europe/Berlin" (default: system local)`)
+	f.StringVar(&outputTimezone, "output-timezone", "", "Time zone to show timestamps in (default: --timezone)")
+	f.StringSliceVar(&hideEvents, "hide-events", nil, `Omit system messages of these kinds (e.g. "encryption,security-code-changed")`)
+	f.StringVar(&backend, "transcriber", "openai", `Transcription backends to try in order: "openai", "local" (whisper.cpp) and "cache", e.g. "cache,local,openai" (config: transcription_backends)`)
+	f.StringVar(&openaiBaseURL, "base-url", "", "Base URL of an OpenAI-compatible API (config: openai_base_url)")
+	f.StringVar(&model, "model", "whisper-1", `OpenAI transcription model, e.g. "gpt-4o-transcribe" (config: openai_model)`)
+	f.StringVar(&language, "language", "", `Spoken language as ISO-639-1 code, e.g. "de" (default: detect; config: transcription_language)`)
+	f.StringVar(&prompt, "prompt", "", "Prompt guiding the transcripts' vocabulary and style (config: transcription_prompt)")
+	f.BoolVar(&noVocabulary, "no-vocabulary", false, "Don't add participant names and proper nouns from the chat to the prompt")
+	f.Float64Var(&temperature, "temperature", 0, "Sampling temperature of the transcription (default: API default; config: openai_temperature)")
+	f.DurationVar(&timeout, "timeout", 0, "Timeout per transcription request, e.g. 2m (default: none; config: openai_timeout)")
+	f.IntVar(&concurrency, "concurrency", 4, "Number of voice messages transcribed in parallel")
+	f.IntVar(&maxRetries, "max-retries", transcriber.DefaultRetryPolicy.MaxRetries, "Retries of a failed transcription request (rate limits, server and network errors)")
+	f.IntVar(&rpm, "requests-per-minute", 0, "Limit transcription requests per minute across all workers (0: no limit)")
+	f.Float64Var(&maxCost, "max-cost", 0, "Stop before the estimated transcription cost exceeds this many USD (0: no limit)")
+	f.Float64Var(&maxAudioMinutes, "max-audio-minutes", 0, "Stop before more than this many minutes of audio are transcribed (0: no limit)")
+	f.BoolVar(&noCache, "no-cache", false, `Don't use or fill the transcription cache (see "wachat cache")`)
+	f.BoolVar(&incremental, "incremental", false, "Only process messages newer than the last incremental run; appends to --output")
 }
 
 func configDir() string {
@@ -64,6 +129,35 @@ func configDir() string {
 	return filepath.Clean(filepath.Join(configHome, app.ApplicationName))
 }
 
+// cacheDir holds data that can be recreated, such as transcripts.
+func cacheDir() string {
+	cacheHome := os.Getenv("XDG_CACHE_HOME")
+	if cacheHome == "" {
+		home, err := os.UserHomeDir()
+		cobra.CheckErr(err)
+		cacheHome = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Clean(filepath.Join(cacheHome, app.ApplicationName))
+}
+
+func transcriptCache() *cache.FileStore {
+	return &cache.FileStore{Dir: filepath.Join(cacheDir(), "transcripts")}
+}
+
+// dataDir holds state that is kept between runs, such as the progress of
+// incremental processing.
+func dataDir() string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		cobra.CheckErr(err)
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Clean(filepath.Join(dataHome, app.ApplicationName))
+}
+
 func initConfig() {
 	dir := configDir()
 
@@ -76,6 +170,10 @@ func initConfig() {
 	viper.SetConfigType("json")
 	viper.SetConfigName("config")
 
+	viper.SetDefault("whisper_binary", "whisper-cli")
+	viper.SetDefault("ffmpeg_binary", "ffmpeg")
+	viper.SetDefault("ffprobe_binary", "ffprobe")
+
 	viper.SetEnvKeyReplacer(strings.NewReplacer(`.`, `_`))
 	viper.AutomaticEnv()
 
@@ -91,58 +189,184 @@ func initConfig() {
 }
 
 func runRoot(cmd *cobra.Command, args []string) error {
-	exportPath := args[0]
+	loc, err := loadLocation(timezone, time.Local)
+	if err != nil {
+		return fmt.Errorf("parsing --timezone: %w", err)
+	}
+
+	outLoc, err := loadLocation(outputTimezone, loc)
+	if err != nil {
+		return fmt.Errorf("parsing --output-timezone: %w", err)
+	}
 
-	from, err := parseTime(fromStr)
+	from, err := parseTime(fromStr, loc, false)
 	if err != nil {
 		return fmt.Errorf("parsing --from: %w", err)
 	}
 
-	to, err := parseTime(toStr)
+	// If --to is date-only, it includes the whole day
+	to, err := parseTime(toStr, loc, true)
 	if err != nil {
 		return fmt.Errorf("parsing --to: %w", err)
 	}
 
-	// If --to is date-only, set to end of day
-	if to != nil && !strings.Contains(toStr, " ") {
-		endOfDay := to.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
-		to = &endOfDay
+	p := &parser.WhatsAppParser{Locale: locale, Location: loc, Strict: strict}
+
+	if detect {
+		defer p.Cleanup()
+		for _, exportPath := range args {
+			det, err := p.Detect(exportPath)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", exportPath, det)
+		}
+		return nil
 	}
 
-	p := &parser.WhatsAppParser{}
+	if err := applyConfig(cmd); err != nil {
+		return err
+	}
 
-	var t domain.Transcriber
-	if dryRun {
-		t = &dryRunTranscriber{w: os.Stderr}
-	} else {
-		t = transcriber.NewOpenAITranscriber()
+	t, err := newTranscriber(cmd)
+	if err != nil {
+		return err
 	}
 
-	r := &renderer.TextRenderer{Markdown: format == "markdown"}
+	budget, err := newBudget()
+	if err != nil {
+		return err
+	}
+
+	hiddenKinds, err := parseEventKinds(hideEvents)
+	if err != nil {
+		return fmt.Errorf("parsing --hide-events: %w", err)
+	}
+
+	tr := &renderer.TextRenderer{
+		Markdown:    format == "markdown",
+		Location:    outLoc,
+		HideDeleted: hideDeleted,
+		HideEvents:  hiddenKinds,
+		Timestamps:  voiceTimestamps,
+	}
+	var r domain.ChatRenderer = tr
+	switch format {
+	case "text", "markdown":
+	case "html":
+		r = &renderer.HTMLRenderer{TextRenderer: tr, MediaBase: mediaBase(args)}
+	default:
+		return fmt.Errorf(`unknown format %q (expected "text", "markdown" or "html")`, format)
+	}
+
+	var store domain.StateStore = &state.FileStore{Dir: filepath.Join(dataDir(), "state")}
+	if dryRun {
+		store = state.ReadOnly{StateStore: store}
+	}
 
-	svc := app.NewChatService(p, t, r)
+	svc := app.NewChatService(p, t, r, store, audio.Prober{})
 
 	w := os.Stdout
 	if output != "" {
-		f, err := os.Create(output)
+		f, err := openOutput(output, incremental)
 		if err != nil {
 			return fmt.Errorf("creating output file: %w", err)
 		}
 		defer f.Close()
 		w = f
+
+		// New messages continue an existing file, which already has
+		// the header.
+		if info, err := f.Stat(); err == nil && info.Size() > 0 {
+			tr.NoHeader = true
+		}
 	}
 
-	ctx := context.Background()
-	if err := svc.Process(ctx, exportPath, from, to, w); err != nil {
+	// Ctrl-C stops the run cleanly: pending transcriptions are canceled
+	// and the output ends with the last finished message.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := app.Options{
+		From:        from,
+		To:          to,
+		Incremental: incremental,
+		Concurrency: concurrency,
+		Language:    language,
+		Prompt:      prompt,
+		Vocabulary:  !noVocabulary,
+		Budget:      budget,
+		Confirm:     confirmBudget(budget),
+		// The dry run reports what the run would transcribe.
+		CollectUsage: dryRun,
+	}
+	report, err := svc.Process(ctx, args, opts, w)
+	printFailures(os.Stderr, report)
+	printBudget(budget, report)
+	if err != nil {
 		p.Cleanup()
 		return err
 	}
 
+	if dryRun {
+		printUsage(os.Stderr, report.Usage)
+	}
+
+	for _, path := range args {
+		det := p.Detections[path]
+		if det == nil || !det.Ambiguous {
+			continue
+		}
+		export := ""
+		if len(args) > 1 {
+			export = " in " + path
+		}
+		fmt.Fprintf(os.Stderr, "Warning: day/month order%s is ambiguous, assumed %s (%s); use --locale to override\n",
+			export, det.DateOrder, det.Locale)
+	}
+
 	p.Cleanup()
 	return nil
 }
 
-func parseTime(s string) (*time.Time, error) {
+// mediaBase returns the directory holding the attachments of a single
+// extracted export or bare chat file, for the audio players of the HTML
+// output. Attachments in a zip can't be linked; they are expected next to
+// the page.
+func mediaBase(args []string) string {
+	if len(args) != 1 || strings.EqualFold(filepath.Ext(args[0]), ".zip") {
+		return ""
+	}
+	dir := args[0]
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(abs)
+}
+
+// openOutput creates the output file, or opens it for appending in
+// incremental mode.
+func openOutput(name string, appendTo bool) (*os.File, error) {
+	if appendTo {
+		return os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644) //nolint:gosec // output path is given by the user
+	}
+	return os.Create(name)
+}
+
+func loadLocation(name string, fallback *time.Location) (*time.Location, error) {
+	if name == "" {
+		return fallback, nil
+	}
+	return time.LoadLocation(name)
+}
+
+// parseTime parses a --from/--to value as wall-clock time in loc. With
+// endOfDay, a date without time means the last second of that day.
+func parseTime(s string, loc *time.Location, endOfDay bool) (*time.Time, error) {
 	if s == "" {
 		return nil, nil
 	}
@@ -154,20 +378,90 @@ func parseTime(s string) (*time.Time, error) {
 
 	for _, f := range formats {
 		t, err := time.Parse(f, s)
-		if err == nil {
-			return &t, nil
+		if err != nil {
+			continue
 		}
+		if endOfDay && !strings.Contains(s, " ") {
+			t = t.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
+		}
+		local := domain.WallClock(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), loc)
+		return &local, nil
 	}
 
 	return nil, fmt.Errorf("unknown time format: %q (expected DD.MM.YYYY or DD.MM.YYYY HH:MM)", s)
 }
 
-// dryRunTranscriber logs which files would be sent to the Whisper API.
-type dryRunTranscriber struct {
-	w io.Writer
+func parseEventKinds(names []string) ([]domain.SystemEventKind, error) {
+	kinds := make([]domain.SystemEventKind, 0, len(names))
+	for _, name := range names {
+		kind, ok := domain.ParseSystemEventKind(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown event kind %q", name)
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// printFailures lists the failed transcriptions of a run in one block.
+func printFailures(w io.Writer, report *app.Report) {
+	if report == nil || len(report.Failed) == 0 {
+		return
+	}
+	total := report.Transcribed + len(report.Failed)
+	fmt.Fprintf(w, "Warning: %d of %d voice message(s) could not be transcribed:\n", len(report.Failed), total)
+	for _, f := range report.Failed {
+		fmt.Fprintf(w, "  %s: %v\n", f.MediaRef, f.Err)
+	}
+}
+
+// printUsage prints the voice messages a run would transcribe, their
+// duration per sender and the estimated cost with each known model.
+func printUsage(w io.Writer, usage *app.Usage) {
+	fmt.Fprintf(w, "\n%d voice message(s) to transcribe, %s", usage.VoiceMessages, formatDuration(usage.Duration))
+	if usage.Unknown > 0 {
+		fmt.Fprintf(w, " (%d of unknown length)", usage.Unknown)
+	}
+	fmt.Fprintln(w)
+	if usage.VoiceMessages == 0 {
+		return
+	}
+
+	fmt.Fprintln(w)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Sender\tVoice messages\tDuration")
+	for _, s := range usage.BySender {
+		length := formatDuration(s.Duration)
+		if s.Unknown > 0 {
+			length += fmt.Sprintf(" + %d unknown", s.Unknown)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", s.Sender, s.VoiceMessages, length)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Model\tUSD/min\tEstimated cost")
+	configured := false
+	for _, price := range transcriber.Prices {
+		name := price.Model
+		if usesBackend("openai") && price.Model == model {
+			name += " (configured)"
+			configured = true
+		}
+		fmt.Fprintf(tw, "%s\t%.3f\t$%.2f\n", name, price.PerMinute, price.Cost(usage.Duration))
+	}
+	if usesBackend("openai") && !configured {
+		fmt.Fprintf(tw, "%s (configured)\t-\tunknown\n", model)
+	}
+	if usesBackend("local") {
+		fmt.Fprintln(tw, "whisper.cpp (configured)\t-\tno API cost")
+	}
+	tw.Flush()
 }
 
-func (d *dryRunTranscriber) Transcribe(_ context.Context, audioPath string) (string, error) {
-	fmt.Fprintf(d.w, "[dry-run] Would transcribe: %s (POST /v1/audio/transcriptions, model=whisper-1)\n", audioPath)
-	return "[dry-run: transcription skipped]", nil
+// formatDuration formats d as minutes and seconds, e.g. "12:05 min".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d min", int(d.Minutes()), int(d.Seconds())%60)
 }
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/joern1811/wachat/internal/adapter/transcriber"
+	"github.com/joern1811/wachat/internal/domain"
+)
+
+// configKeys maps transcription flags to the config keys they default to.
+// The keys are also read from the environment in upper case, so generic
+// names like "language" (LANGUAGE is set by gettext) are avoided.
+var configKeys = map[string]string{
+	"base-url":    "openai_base_url",
+	"model":       "openai_model",
+	"language":    "transcription_language",
+	"prompt":      "transcription_prompt",
+	"temperature": "openai_temperature",
+	"timeout":     "openai_timeout",
+	"transcriber": "transcription_backends",
+}
+
+// applyConfig sets the flags in configKeys that were not given on the command
+// line from the config file or environment, so flags take precedence.
+func applyConfig(cmd *cobra.Command) error {
+	for flag, key := range configKeys {
+		if cmd.Flags().Changed(flag) || !viper.IsSet(key) {
+			continue
+		}
+		if err := cmd.Flags().Set(flag, viper.GetString(key)); err != nil {
+			return fmt.Errorf("config %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// newTranscriber builds the chain of transcribers given with --transcriber,
+// e.g. "cache,local,openai". Each backend is wrapped in the transcription
+// cache unless --no-cache is set; "cache" looks up the transcripts of all
+// backends before any of them is tried. applyConfig must have been called
+// before.
+func newTranscriber(cmd *cobra.Command) (domain.Transcriber, error) {
+	var (
+		backends []transcriber.Backend
+		variants []string
+		targets  []string
+		cacheAt  = -1
+	)
+	for _, name := range backendNames() {
+		var (
+			t        domain.Transcriber
+			variant  string
+			classify func(error) transcriber.Failure
+		)
+		switch name {
+		case "cache":
+			if cacheAt < 0 && !noCache {
+				cacheAt = len(backends)
+				targets = append(targets, "transcript cache")
+			}
+			continue
+
+		case "openai":
+			retry := transcriber.DefaultRetryPolicy
+			retry.MaxRetries = maxRetries
+			opts := transcriber.OpenAIOptions{
+				BaseURL: openaiBaseURL,
+				Model:   model,
+				Timeout: timeout,
+				Retry:   retry,
+				Limiter: transcriber.NewRateLimiter(rpm),
+				// Only the timestamps and the HTML page use segments.
+				Segments: voiceTimestamps || format == "html",
+			}
+			if cmd.Flags().Changed("temperature") {
+				opts.Temperature = &temperature
+			}
+			ot := transcriber.NewOpenAITranscriber(opts)
+			t = transcriber.NewSplitter(ot, viper.GetString("ffmpeg_binary"), viper.GetString("ffprobe_binary"))
+			variant, classify = ot.Variant(), transcriber.ClassifyOpenAI
+			targets = append(targets, "POST /v1/audio/transcriptions, model="+ot.Model())
+
+		case "local":
+			if dryRun {
+				// Nothing is run, so whisper.cpp needn't be installed.
+				targets = append(targets, transcriber.LocalVariant(viper.GetString("whisper_model")))
+				continue
+			}
+			lt, err := transcriber.NewLocalTranscriber(
+				viper.GetString("whisper_binary"),
+				viper.GetString("whisper_model"),
+				viper.GetString("ffmpeg_binary"),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("local transcriber (see whisper_* in %s/config.json): %w", configDir(), err)
+			}
+			t, variant, classify = lt, lt.Variant(), transcriber.ClassifyLocal
+			targets = append(targets, variant)
+
+		default:
+			return nil, fmt.Errorf(`unknown transcriber %q (expected "openai", "local" or "cache")`, name)
+		}
+
+		if !noCache {
+			t = &transcriber.Cached{Next: t, Store: transcriptCache(), Variant: variant, Prompt: prompt}
+		}
+		backends = append(backends, transcriber.Backend{Name: name, Transcriber: t, Classify: classify})
+		variants = append(variants, variant)
+	}
+
+	if dryRun {
+		return &dryRunTranscriber{w: os.Stderr, target: strings.Join(targets, ", falling back to ")}, nil
+	}
+	if cacheAt >= 0 {
+		lookup := transcriber.Backend{
+			Name:        "cache",
+			Transcriber: &transcriber.CacheOnly{Store: transcriptCache(), Variants: variants, Prompt: prompt},
+			Classify:    transcriber.ClassifyCacheOnly,
+			Lookup:      true,
+		}
+		backends = slices.Insert(backends, cacheAt, lookup)
+	}
+	if len(backends) == 0 {
+		return nil, errors.New("no transcriber configured")
+	}
+	return transcriber.NewFallback(os.Stderr, backends...), nil
+}
+
+// backendNames splits --transcriber into the names of the backends.
+func backendNames() []string {
+	var names []string
+	for name := range strings.SplitSeq(backend, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// usesBackend reports whether --transcriber includes the backend name.
+func usesBackend(name string) bool {
+	return slices.Contains(backendNames(), name)
+}
+
+// dryRunTranscriber logs which files would be transcribed, how and how long
+// they are.
+type dryRunTranscriber struct {
+	w      io.Writer
+	target string
+}
+
+func (d *dryRunTranscriber) Transcribe(_ context.Context, req domain.TranscriptionRequest) (*domain.Transcript, error) {
+	length := "unknown length"
+	if req.Duration > 0 {
+		length = formatDuration(req.Duration)
+	}
+	fmt.Fprintf(d.w, "[dry-run] Would transcribe: %s (%s, %s)\n", req.Path, length, d.target)
+	return &domain.Transcript{Text: "[dry-run: transcription skipped]"}, nil
+}
@@ -1,23 +1,43 @@
 package domain
 
-import "time"
+import (
+	"io/fs"
+	"time"
+)
 
 type Chat struct {
+	Meta     Metadata
 	Messages []Message
+	// Media gives access to the export's attachments. Message.MediaRef
+	// values are paths within this file system.
+	Media fs.FS
+}
+
+// Metadata describes a chat and the export it was read from.
+type Metadata struct {
+	// Title is the chat name (contact or group), taken from the export's
+	// file name, e.g. "John" for "WhatsApp Chat - John.zip".
+	Title string
+	// Participants lists every sender in order of their first message.
+	Participants []string
+	// Platform is the WhatsApp client that created the export ("iOS" or
+	// "Android").
+	Platform string
+	// Locale is the detected export language (e.g. "de").
+	Locale string
+	// ExportedAt is the modification time of the chat file.
+	ExportedAt time.Time
 }
 
 // Filter returns a new Chat containing only messages within the given time range.
 // nil values for from/to mean no lower/upper bound.
 func (c *Chat) Filter(from, to *time.Time) *Chat {
-	filtered := &Chat{}
-	for _, msg := range c.Messages {
-		if from != nil && msg.Timestamp.Before(*from) {
-			continue
-		}
-		if to != nil && msg.Timestamp.After(*to) {
-			continue
+	inRange := InRange(from, to)
+	filtered := &Chat{Meta: c.Meta, Media: c.Media}
+	for i := range c.Messages {
+		if inRange(&c.Messages[i]) {
+			filtered.Messages = append(filtered.Messages, c.Messages[i])
 		}
-		filtered.Messages = append(filtered.Messages, msg)
 	}
 	return filtered
 }
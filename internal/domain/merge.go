@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"errors"
+	"io/fs"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Merge combines several exports of the same chat into one continuous chat.
+// Messages present in more than one export are kept once; if one copy has
+// its attachment and another doesn't, the one with the attachment wins.
+// Media is resolved from whichever export contains it.
+func Merge(chats ...*Chat) *Chat {
+	merged := &Chat{}
+	media := make(MultiFS, 0, len(chats))
+	index := make(map[string]int) // dedup key → position in merged.Messages
+
+	for _, c := range chats {
+		if c.Media != nil {
+			media = append(media, c.Media)
+		}
+		mergeMetadata(&merged.Meta, &c.Meta)
+
+		// Identical messages within one export (e.g. "ok" twice in the same
+		// minute) are legitimate; they are told apart by their occurrence.
+		occurrences := make(map[string]int)
+		for _, msg := range c.Messages {
+			key := dedupKey(&msg)
+			occurrences[key]++
+			key += "#" + strconv.Itoa(occurrences[key])
+
+			if i, ok := index[key]; ok {
+				if hasBetterMedia(&msg, &merged.Messages[i]) {
+					merged.Messages[i] = msg
+				}
+				continue
+			}
+			index[key] = len(merged.Messages)
+			merged.Messages = append(merged.Messages, msg)
+		}
+	}
+
+	slices.SortStableFunc(merged.Messages, func(a, b Message) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+
+	merged.Media = media
+	for i := range merged.Messages {
+		if ref := merged.Messages[i].MediaRef; ref != "" {
+			_, err := fs.Stat(media, ref)
+			merged.Messages[i].MediaMissing = err != nil
+		}
+	}
+
+	return merged
+}
+
+// dedupKey identifies a message across exports. For media, attachment names
+// and the type are left out: iOS numbers attachments per export, and Android
+// exports without media replace them with an untyped "<Media omitted>".
+func dedupKey(msg *Message) string {
+	key := msg.Timestamp.UTC().Format(time.RFC3339) + "\x00" + msg.Sender + "\x00"
+	if msg.MediaRef != "" || msg.MediaMissing {
+		return key + "media"
+	}
+	return key + strconv.Itoa(int(msg.Type)) + "\x00" + msg.Content
+}
+
+// hasBetterMedia reports whether msg should replace old, the copy of the
+// same message from another export: it has the attachment old lacks.
+func hasBetterMedia(msg, old *Message) bool {
+	if old.MediaMissing && !msg.MediaMissing {
+		return true
+	}
+	return old.MediaRef == "" && msg.MediaRef != ""
+}
+
+func mergeMetadata(dst, src *Metadata) {
+	if dst.Title == "" {
+		dst.Title = src.Title
+	}
+	if dst.Platform == "" {
+		dst.Platform = src.Platform
+	}
+	if dst.Locale == "" {
+		dst.Locale = src.Locale
+	}
+	if src.ExportedAt.After(dst.ExportedAt) {
+		dst.ExportedAt = src.ExportedAt
+	}
+	for _, p := range src.Participants {
+		if !slices.Contains(dst.Participants, p) {
+			dst.Participants = append(dst.Participants, p)
+		}
+	}
+}
+
+// MultiFS is a union of file systems: Open returns the file from the first
+// file system that has it.
+type MultiFS []fs.FS
+
+func (m MultiFS) Open(name string) (fs.File, error) {
+	for _, fsys := range m {
+		f, err := fsys.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestMergeMediaOmitted(t *testing.T) {
+	ts := time.Date(2024, 1, 15, 9, 15, 0, 0, time.UTC)
+	const voice = "PTT-20240115-WA0001.opus"
+
+	withoutMedia := &Chat{Messages: []Message{
+		{Timestamp: ts, Sender: "Anna", Type: TextMessage, MediaMissing: true},
+		{Timestamp: ts, Sender: "Anna", Type: TextMessage, Content: "ok"},
+	}}
+	withMedia := &Chat{
+		Media: fstest.MapFS{voice: &fstest.MapFile{}},
+		Messages: []Message{
+			{Timestamp: ts, Sender: "Anna", Type: VoiceMessage, Content: voice, MediaRef: voice},
+			{Timestamp: ts, Sender: "Anna", Type: TextMessage, Content: "ok"},
+		},
+	}
+
+	for _, order := range [][]*Chat{{withoutMedia, withMedia}, {withMedia, withoutMedia}} {
+		merged := Merge(order...)
+		if len(merged.Messages) != 2 {
+			t.Fatalf("got %d messages, want 2", len(merged.Messages))
+		}
+		got := merged.Messages[0]
+		if got.Type != VoiceMessage || got.MediaRef != voice || got.MediaMissing {
+			t.Errorf("merged message: type %d, ref %q, missing %v, want the voice message with its attachment",
+				got.Type, got.MediaRef, got.MediaMissing)
+		}
+	}
+}
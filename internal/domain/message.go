@@ -11,12 +11,143 @@ const (
 	VideoMessage
 	DocumentMessage
 	SystemMessage
+	StickerMessage
+	GIFMessage
+	ContactMessage  // Contact card (.vcf), see Message.Contact
+	LocationMessage // Static or live location, see Message.Location
+	PollMessage     // Poll with options, see Message.Poll
 )
 
 type Message struct {
 	Timestamp time.Time
 	Sender    string
-	Content   string      // Text or transcribed text
+	Content   string // Text or transcribed text
 	Type      MessageType
-	MediaRef  string      // Filename (e.g. "PTT-20240115-WA0000.opus")
+	MediaRef  string // Path within Chat.Media (e.g. "PTT-20240115-WA0000.opus")
+
+	Edited   bool // Message was edited after sending
+	Deleted  bool // Message was deleted; Content is empty
+	ViewOnce bool // "View once" media, never included in an export
+	// MediaMissing marks attachments that are not part of the export (e.g.
+	// exported "without media"). MediaRef may be empty.
+	MediaMissing bool
+
+	// Transcript is set for transcribed voice messages; Content holds its
+	// text.
+	Transcript *Transcript
+
+	// Structured payloads, set depending on Type.
+	Poll     *Poll
+	Location *Location
+	Contact  *Contact
+
+	// Event is set for system messages.
+	Event *SystemEvent
+}
+
+// Poll is a WhatsApp poll with its options and vote counts at export time.
+type Poll struct {
+	Question string
+	Options  []PollOption
+}
+
+type PollOption struct {
+	Text  string
+	Votes int
+}
+
+// Location is a shared location. Live locations carry no coordinates in
+// exports.
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	URL       string
+	Live      bool
+}
+
+// Contact is a shared contact card.
+type Contact struct {
+	Name    string
+	Numbers []string
+}
+
+// Transcript is the transcribed text of a voice message.
+type Transcript struct {
+	Text string
+	// Segments split the text by its position in the audio, if the
+	// transcriber reports them.
+	Segments []Segment
+	// Cached reports that the transcript was reused from an earlier run
+	// instead of sending the audio again.
+	Cached bool
+}
+
+// Segment is a part of a transcript.
+type Segment struct {
+	Start time.Duration `json:"start"`
+	End   time.Duration `json:"end"`
+	Text  string        `json:"text"`
+}
+
+// SystemEventKind classifies system messages.
+type SystemEventKind int
+
+const (
+	EventOther SystemEventKind = iota
+	EventEncryptionNotice
+	EventGroupCreated
+	EventMemberAdded
+	EventMemberRemoved
+	EventMemberLeft
+	EventMemberJoined
+	EventGroupRenamed
+	EventDescriptionChanged
+	EventIconChanged
+	EventSecurityCodeChanged
+	EventNumberChanged
+	EventMissedVoiceCall
+	EventMissedVideoCall
+)
+
+var systemEventNames = map[SystemEventKind]string{
+	EventOther:               "other",
+	EventEncryptionNotice:    "encryption",
+	EventGroupCreated:        "group-created",
+	EventMemberAdded:         "member-added",
+	EventMemberRemoved:       "member-removed",
+	EventMemberLeft:          "member-left",
+	EventMemberJoined:        "member-joined",
+	EventGroupRenamed:        "group-renamed",
+	EventDescriptionChanged:  "description-changed",
+	EventIconChanged:         "icon-changed",
+	EventSecurityCodeChanged: "security-code-changed",
+	EventNumberChanged:       "number-changed",
+	EventMissedVoiceCall:     "missed-voice-call",
+	EventMissedVideoCall:     "missed-video-call",
+}
+
+func (k SystemEventKind) String() string {
+	return systemEventNames[k]
+}
+
+// ParseSystemEventKind returns the kind with the given name (see String).
+func ParseSystemEventKind(name string) (SystemEventKind, bool) {
+	for k, n := range systemEventNames {
+		if n == name {
+			return k, true
+		}
+	}
+	return EventOther, false
+}
+
+// SystemEvent describes what a system message is about.
+type SystemEvent struct {
+	Kind SystemEventKind
+	// Actor is who performed the action (e.g. the admin adding members).
+	Actor string
+	// Participants are the members affected by the event.
+	Participants []string
+	// Value is the new group subject for EventGroupRenamed and
+	// EventGroupCreated.
+	Value string
 }
@@ -2,20 +2,62 @@ package domain
 
 import (
 	"context"
+	"errors"
 	"io"
+	"io/fs"
+	"time"
 )
 
 // ChatParser parses a WhatsApp export into a Chat.
 type ChatParser interface {
 	Parse(exportPath string) (*Chat, error)
+	// Stream is like Parse, but reads the messages lazily while the
+	// returned stream is iterated.
+	Stream(exportPath string) (*ChatStream, error)
+}
+
+// TranscriptionRequest identifies an audio attachment to transcribe.
+type TranscriptionRequest struct {
+	// Media is the file system holding the export's attachments.
+	Media fs.FS
+	// Path is the attachment's path within Media (Message.MediaRef).
+	Path string
+	// Language is the spoken language as ISO-639-1 code (e.g. "de").
+	// Empty lets the transcriber detect it.
+	Language string
+	// Prompt guides the transcript's vocabulary and style, e.g. with
+	// names mentioned in the chat. Empty means no prompt.
+	Prompt string
+	// Duration is the length of the audio, if it was read before; zero
+	// means unknown.
+	Duration time.Duration
 }
 
 // Transcriber transcribes an audio file to text.
 type Transcriber interface {
-	Transcribe(ctx context.Context, audioPath string) (string, error)
+	Transcribe(ctx context.Context, req TranscriptionRequest) (*Transcript, error)
 }
 
-// ChatRenderer renders a Chat to an output writer.
+// ErrTranscriberUnavailable is returned by a Transcriber that can't
+// transcribe anything anymore, e.g. because the API key's quota is used up.
+var ErrTranscriberUnavailable = errors.New("no transcriber available")
+
+// AudioProber reads the duration of an audio attachment from its container
+// headers, without decoding it.
+type AudioProber interface {
+	Duration(media fs.FS, path string) (time.Duration, error)
+}
+
+// ChatRenderer renders a chat to an output writer, one message at a time,
+// so output appears while the chat is still being processed.
 type ChatRenderer interface {
-	Render(w io.Writer, chat *Chat) error
+	RenderHeader(w io.Writer, meta *Metadata) error
+	RenderMessage(w io.Writer, msg *Message) error
+}
+
+// StateStore persists incremental processing state per chat.
+type StateStore interface {
+	// Load returns the state saved for chatKey, or nil if there is none.
+	Load(chatKey string) (*ProcessState, error)
+	Save(chatKey string, state *ProcessState) error
 }
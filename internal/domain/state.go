@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// ProcessState records how far a chat has been processed, so later runs
+// can handle only newer messages.
+type ProcessState struct {
+	LastTimestamp time.Time `json:"last_timestamp"`
+	// LastHash is Message.Hash of the last processed message. It tells
+	// messages apart that share LastTimestamp.
+	LastHash string `json:"last_hash"`
+	// LastOccurrence counts the messages identical to the last processed
+	// one up to and including it (e.g. "ok" twice in the same minute).
+	// Zero, as in older state files, counts as one.
+	LastOccurrence int `json:"last_occurrence,omitempty"`
+	// Seen counts the processed messages with LastTimestamp by hash, so
+	// a later run continues counting their occurrences.
+	Seen      map[string]int `json:"seen,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// Advance records msg as the last processed message. The messages must be
+// passed in order, starting after the state's last message.
+func (p *ProcessState) Advance(msg *Message) {
+	hash := msg.Hash()
+	switch {
+	case !msg.Timestamp.Equal(p.LastTimestamp):
+		p.Seen = make(map[string]int)
+	case p.Seen == nil:
+		// Older state files only know the last message.
+		p.Seen = map[string]int{p.LastHash: max(p.LastOccurrence, 1)}
+	}
+	p.Seen[hash]++
+
+	p.LastTimestamp = msg.Timestamp
+	p.LastHash = hash
+	p.LastOccurrence = p.Seen[hash]
+}
+
+// Hash identifies a message independently of transcription and of the
+// export it was read from.
+func (m *Message) Hash() string {
+	sum := sha256.Sum256([]byte(dedupKey(m)))
+	return hex.EncodeToString(sum[:])
+}
+
+// Since returns a new ChatStream with the messages following the last
+// processed one, telling identical messages apart by their occurrence.
+// Until that message is seen, only messages with a later timestamp pass,
+// which also covers a last message deleted since. A nil state returns all
+// messages.
+func (s *ChatStream) Since(state *ProcessState) *ChatStream {
+	if state == nil {
+		return s
+	}
+
+	since := *s
+	since.Messages = func(yield func(Message, error) bool) {
+		seenLast := false
+		occurrence := 0
+		for msg, err := range s.Messages {
+			if err == nil && !seenLast && !msg.Timestamp.After(state.LastTimestamp) {
+				if msg.Timestamp.Equal(state.LastTimestamp) && msg.Hash() == state.LastHash {
+					occurrence++
+					seenLast = occurrence >= state.LastOccurrence
+				}
+				continue
+			}
+			if !yield(msg, err) {
+				return
+			}
+		}
+	}
+	return &since
+}
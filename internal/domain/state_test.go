@@ -0,0 +1,84 @@
+package domain
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSinceIdenticalMessages(t *testing.T) {
+	at := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	chat := &Chat{Messages: []Message{
+		{Timestamp: at, Sender: "Anna", Content: "ok"},
+		{Timestamp: at, Sender: "Anna", Content: "ja"},
+		{Timestamp: at, Sender: "Anna", Content: "ok"},
+		{Timestamp: at, Sender: "Anna", Content: "ja"},
+		{Timestamp: at.Add(time.Minute), Sender: "Ben", Content: "gut"},
+	}}
+	n := len(chat.Messages)
+
+	// Process the chat in three runs, split after every pair of messages,
+	// and check that every message is handled exactly once.
+	for first := 1; first < n; first++ {
+		for second := first; second < n; second++ {
+			var (
+				state *ProcessState
+				got   []Message
+			)
+			for _, limit := range []int{first, second, n} {
+				var since *ProcessState
+				next := &ProcessState{}
+				if state != nil {
+					since = next
+					// The state goes through a state file between runs.
+					data, err := json.Marshal(state)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := json.Unmarshal(data, next); err != nil {
+						t.Fatal(err)
+					}
+				}
+				for msg, err := range chat.Stream().Since(since).Messages {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(got) == limit {
+						break
+					}
+					next.Advance(&msg)
+					got = append(got, msg)
+				}
+				state = next
+			}
+
+			if !slices.EqualFunc(got, chat.Messages, func(a, b Message) bool {
+				return a.Timestamp.Equal(b.Timestamp) && a.Content == b.Content
+			}) {
+				t.Errorf("runs of %d, %d and %d messages processed %q, want each message once",
+					first, second-first, n-second, contents(got))
+			}
+		}
+	}
+}
+
+func TestAdvanceOlderState(t *testing.T) {
+	at := time.Date(2024, 1, 15, 9, 0, 0, 0, time.UTC)
+	ok := Message{Timestamp: at, Sender: "Anna", Content: "ok"}
+
+	// A state file written before occurrences were recorded.
+	state := &ProcessState{LastTimestamp: at, LastHash: ok.Hash()}
+	state.Advance(&ok)
+	if state.LastOccurrence != 2 {
+		t.Errorf("LastOccurrence = %d, want 2", state.LastOccurrence)
+	}
+}
+
+func contents(msgs []Message) []string {
+	out := make([]string, len(msgs))
+	for i, msg := range msgs {
+		out[i] = msg.Content
+	}
+	return out
+}
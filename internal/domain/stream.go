@@ -0,0 +1,61 @@
+package domain
+
+import (
+	"io/fs"
+	"iter"
+	"time"
+)
+
+// ChatStream is a chat whose messages are read one at a time, so chats of
+// any size can be processed in bounded memory.
+type ChatStream struct {
+	Meta Metadata
+	// Messages yields the messages in chat order. Iteration stops after
+	// the first error.
+	Messages iter.Seq2[Message, error]
+	// Media gives access to the export's attachments (see Chat.Media).
+	Media fs.FS
+}
+
+// Stream returns the chat's messages as a ChatStream.
+func (c *Chat) Stream() *ChatStream {
+	return &ChatStream{
+		Meta:  c.Meta,
+		Media: c.Media,
+		Messages: func(yield func(Message, error) bool) {
+			for _, msg := range c.Messages {
+				if !yield(msg, nil) {
+					return
+				}
+			}
+		},
+	}
+}
+
+// Filter returns a new ChatStream yielding only the messages keep reports
+// true for. Errors are passed through.
+func (s *ChatStream) Filter(keep func(*Message) bool) *ChatStream {
+	filtered := *s
+	filtered.Messages = func(yield func(Message, error) bool) {
+		for msg, err := range s.Messages {
+			if err == nil && !keep(&msg) {
+				continue
+			}
+			if !yield(msg, err) {
+				return
+			}
+		}
+	}
+	return &filtered
+}
+
+// InRange returns a predicate for messages within the given time range.
+// nil values for from/to mean no lower/upper bound.
+func InRange(from, to *time.Time) func(*Message) bool {
+	return func(msg *Message) bool {
+		if from != nil && msg.Timestamp.Before(*from) {
+			return false
+		}
+		return to == nil || !msg.Timestamp.After(*to)
+	}
+}
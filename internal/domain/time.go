@@ -0,0 +1,38 @@
+package domain
+
+import "time"
+
+// WallClock returns the instant at which the clocks in loc show the given
+// date and time. Unlike time.Date, DST transitions are resolved
+// deterministically:
+//   - ambiguous times (clocks turned back) resolve to the earlier instant,
+//   - nonexistent times (clocks turned forward) are shifted forward by the
+//     length of the gap, e.g. 02:30 becomes 03:30.
+func WallClock(year int, month time.Month, day, hour, minute, sec int, loc *time.Location) time.Time {
+	utc := time.Date(year, month, day, hour, minute, sec, 0, time.UTC)
+
+	// Zone offsets in effect before and after a possible transition.
+	_, before := utc.Add(-12 * time.Hour).In(loc).Zone()
+	_, after := utc.Add(12 * time.Hour).In(loc).Zone()
+
+	early := utc.Add(-time.Duration(before) * time.Second).In(loc)
+	late := utc.Add(-time.Duration(after) * time.Second).In(loc)
+
+	switch {
+	case sameWallClock(early, utc):
+		return early
+	case sameWallClock(late, utc):
+		return late
+	default:
+		// Nonexistent: the pre-transition offset moves it past the gap.
+		return early
+	}
+}
+
+func sameWallClock(t, wall time.Time) bool {
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := wall.Date()
+	h1, min1, s1 := t.Clock()
+	h2, min2, s2 := wall.Clock()
+	return y1 == y2 && m1 == m2 && d1 == d2 && h1 == h2 && min1 == min2 && s1 == s2
+}